@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// CheckpointStore keeps outputs of pipeline steps keyed by the input sequence number.
+// Records are appended to a local file as JSON lines, so a stopped pipeline can be resumed.
+// Every record has a fingerprint of its input item and the file starts with
+// a fingerprint of the signer settings, so stale outputs are not reused.
+type CheckpointStore struct {
+	mu      sync.Mutex
+	file    *os.File
+	outputs map[checkpointKey]checkpointRecord
+	err     error
+}
+
+type checkpointKey struct {
+	step string
+	seq  int
+}
+
+type checkpointRecord struct {
+	Step  string `json:"step"`
+	Seq   int    `json:"seq"`
+	Input string `json:"input"`
+	Value string `json:"value"`
+}
+
+// checkpointHeader is the first line of the file
+type checkpointHeader struct {
+	Config string `json:"config"`
+}
+
+// fingerprint is the hex sha256 of data, the salt in the config is not saved as is
+func fingerprint(data string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+}
+
+// OpenCheckpointStore opens or creates a checkpoint file and loads saved outputs.
+// config describes the signer settings (hashes, salt etc.), a file made with other
+// settings is not resumed. A broken tail of the file (e.g. after a crash
+// in the middle of a write) is dropped.
+func OpenCheckpointStore(path string, config string) (*CheckpointStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	cs := &CheckpointStore{
+		file:    file,
+		outputs: make(map[checkpointKey]checkpointRecord),
+	}
+
+	config = fingerprint(config)
+	valid, err := cs.load(config)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cant load checkpoint %s: %s", path, err)
+	}
+
+	// drop everything after the last valid record and continue from there
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(valid, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if valid == 0 {
+		line, _ := json.Marshal(checkpointHeader{Config: config})
+		if _, err := file.Write(append(line, '\n')); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	return cs, nil
+}
+
+// load checks the header, reads records and returns size of the valid part of the file
+func (cs *CheckpointStore) load(config string) (int64, error) {
+	reader := bufio.NewReader(cs.file)
+	line, err := reader.ReadBytes('\n')
+	if err == io.EOF {
+		// a new file or the header was not written completely
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	header := checkpointHeader{}
+	if err := json.Unmarshal(bytes.TrimSpace(line), &header); err != nil || header.Config != config {
+		return 0, fmt.Errorf("it was made with other signer settings, remove it to start again")
+	}
+
+	valid := int64(len(line))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// the last line without '\n' was not written completely
+			return valid, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		record := checkpointRecord{}
+		if err := json.Unmarshal(bytes.TrimSpace(line), &record); err != nil {
+			return valid, nil
+		}
+		cs.outputs[checkpointKey{record.Step, record.Seq}] = record
+		valid += int64(len(line))
+	}
+}
+
+// Get returns a saved output of the step for the item with the sequence number seq.
+// Nothing is returned if the output was saved for another item.
+func (cs *CheckpointStore) Get(step string, seq int, item string) (string, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	record, ok := cs.outputs[checkpointKey{step, seq}]
+	if !ok || record.Input != fingerprint(item) {
+		return "", false
+	}
+	return record.Value, true
+}
+
+// Put saves an output of the step for the item with the sequence number seq.
+// After the first failed write the store stops writing and returns the error from Err.
+func (cs *CheckpointStore) Put(step string, seq int, item string, value string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.err != nil {
+		return cs.err
+	}
+
+	record := checkpointRecord{Step: step, Seq: seq, Input: fingerprint(item), Value: value}
+	line, err := json.Marshal(record)
+	if err != nil {
+		cs.err = err
+		return err
+	}
+	if _, err := cs.file.Write(append(line, '\n')); err != nil {
+		cs.err = err
+		return err
+	}
+
+	cs.outputs[checkpointKey{step, seq}] = record
+	return nil
+}
+
+// Err returns the first error happened while saving outputs
+func (cs *CheckpointStore) Err() error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.err
+}
+
+// Close closes the checkpoint file
+func (cs *CheckpointStore) Close() error {
+	return cs.file.Close()
+}
+
+// Step is a named calculation made for every item of a checkpointed pipeline
+type Step struct {
+	Name string
+	Fn   func(data string) string
+}
+
+// Steps returns steps of the signature: SingleHash and MultiHash
+func (s *Signer) Steps() []Step {
+	return []Step{
+		{Name: "SingleHash", Fn: s.singleHash},
+		{Name: "MultiHash", Fn: s.multiHash},
+	}
+}
+
+// runSteps continues calculation of the item from the last step saved for it
+func runSteps(store *CheckpointStore, steps []Step, seq int, item string) string {
+	start, data := 0, item
+	for i := len(steps) - 1; i >= 0; i-- {
+		if value, ok := store.Get(steps[i].Name, seq, item); ok {
+			data, start = value, i+1
+			break
+		}
+	}
+
+	for _, step := range steps[start:] {
+		data = step.Fn(data)
+		store.Put(step.Name, seq, item, data)
+	}
+	return data
+}
+
+// Checkpointed returns a job running steps for every input item and saving
+// the output of each step into the store. Items are numbered in the order of arrival,
+// an item changed since the saved run is calculated again. Results are sent in the input order.
+func (s *Signer) Checkpointed(store *CheckpointStore, steps ...Step) job {
+	return func(in, out chan interface{}) {
+		s.forEachOrdered(in, out, "Checkpointed", func(seq int, data string) string {
+			return runSteps(store, steps, seq, data)
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func countingSteps(calls *uint32) []Step {
+	return []Step{
+		{Name: "Wrap", Fn: func(data string) string {
+			atomic.AddUint32(calls, 1)
+			return "<" + data + ">"
+		}},
+		{Name: "Double", Fn: func(data string) string {
+			atomic.AddUint32(calls, 1)
+			return data + data
+		}},
+	}
+}
+
+const testConfig = "checksum=crc32 digest=md5"
+
+func runCheckpointed(t *testing.T, path string, steps []Step, inputData []int) []interface{} {
+	store, err := OpenCheckpointStore(path, testConfig)
+	if err != nil {
+		t.Fatalf("cant open checkpoint: %v", err)
+	}
+	defer store.Close()
+
+	s := NewSigner()
+	s.MaxWorkers = 2
+
+	var result []interface{}
+	ExecutePipeline(
+		sendInts(inputData...),
+		s.Checkpointed(store, steps...),
+		collect(&result),
+	)
+	if err := store.Err(); err != nil {
+		t.Fatalf("cant save checkpoint: %v", err)
+	}
+	return result
+}
+
+func TestCheckpointedResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "signer.checkpoint")
+
+	inputData := []int{5, 4, 3, 2, 1}
+
+	var calls uint32
+	first := runCheckpointed(t, path, countingSteps(&calls), inputData[:3])
+	if calls != 6 {
+		t.Errorf("wrong number of calls in the first run, expected 6, got %d", calls)
+	}
+
+	// emulate a crash in the middle of a write
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"step":"Wrap","seq":3,"val`)
+	file.Close()
+
+	calls = 0
+	second := runCheckpointed(t, path, countingSteps(&calls), inputData)
+	if calls != 4 {
+		t.Errorf("wrong number of calls after resume, expected 4, got %d", calls)
+	}
+
+	for i, data := range inputData {
+		s := strconv.Itoa(data)
+		expected := "<" + s + "><" + s + ">"
+		if second[i] != expected {
+			t.Errorf("[%d] wrong result, expected %v, got %v", i, expected, second[i])
+		}
+		if i < len(first) && first[i] != expected {
+			t.Errorf("[%d] wrong result of the first run, expected %v, got %v", i, expected, first[i])
+		}
+	}
+}
+
+func TestCheckpointedPartialItem(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "signer.checkpoint")
+
+	store, err := OpenCheckpointStore(path, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put("Wrap", 0, "7", "[saved]")
+	store.Close()
+
+	var calls uint32
+	result := runCheckpointed(t, path, countingSteps(&calls), []int{7})
+	if calls != 1 {
+		t.Errorf("only the second step must be called, got %d calls", calls)
+	}
+	if expected := "[saved][saved]"; len(result) != 1 || result[0] != expected {
+		t.Errorf("wrong result, expected [%v], got %v", expected, result)
+	}
+}
+
+func TestCheckpointedChangedInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "signer.checkpoint")
+
+	var calls uint32
+	runCheckpointed(t, path, countingSteps(&calls), []int{1, 2, 3})
+
+	// the second item is another one now, only it is calculated again
+	calls = 0
+	result := runCheckpointed(t, path, countingSteps(&calls), []int{1, 5, 3})
+	if calls != 2 {
+		t.Errorf("only the changed item must be calculated, got %d calls", calls)
+	}
+	if expected := "<5><5>"; len(result) != 3 || result[1] != expected {
+		t.Errorf("wrong result, expected %v, got %v", expected, result)
+	}
+}
+
+func TestCheckpointedChangedConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "signer.checkpoint")
+
+	var calls uint32
+	runCheckpointed(t, path, countingSteps(&calls), []int{1})
+
+	if store, err := OpenCheckpointStore(path, testConfig+" salt=x"); err == nil {
+		store.Close()
+		t.Fatal("checkpoint of other settings is resumed")
+	}
+	// the file is kept for the right settings
+	calls = 0
+	runCheckpointed(t, path, countingSteps(&calls), []int{1})
+	if calls != 0 {
+		t.Errorf("nothing must be calculated, got %d calls", calls)
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import "time"
+
+// Clock is a source of time for the signer functions.
+// Tests replace SignerClock to run the pipeline without real sleeping.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// SignerClock is used by DataSignerMd5, DataSignerCrc32, OverheatLock and OverheatUnlock
+var SignerClock Clock = realClock{}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// FakeClock is a Clock whose Sleep returns at once moving the time forward.
+// Sleeps of concurrent goroutines add up, so the elapsed time is the total time
+// of all sleeps whatever order they are made in.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps int
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.sleeps++
+}
+
+// Sleeps returns the number of Sleep calls
+func (c *FakeClock) Sleeps() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sleeps
+}
+
+// the original functions from common.go, TestSigner replaces them
+var (
+	commonOverheatLock    = OverheatLock
+	commonOverheatUnlock  = OverheatUnlock
+	commonDataSignerMd5   = DataSignerMd5
+	commonDataSignerCrc32 = DataSignerCrc32
+)
+
+func useCommonSigners(t *testing.T) {
+	overheatLock, overheatUnlock := OverheatLock, OverheatUnlock
+	dataSignerMd5, dataSignerCrc32 := DataSignerMd5, DataSignerCrc32
+	OverheatLock, OverheatUnlock = commonOverheatLock, commonOverheatUnlock
+	DataSignerMd5, DataSignerCrc32 = commonDataSignerMd5, commonDataSignerCrc32
+	t.Cleanup(func() {
+		OverheatLock, OverheatUnlock = overheatLock, overheatUnlock
+		DataSignerMd5, DataSignerCrc32 = dataSignerMd5, dataSignerCrc32
+	})
+}
+
+func TestSignerClock(t *testing.T) {
+	useCommonSigners(t)
+	begin := time.Date(2019, 4, 18, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(begin)
+	prevClock := SignerClock
+	SignerClock = clock
+	defer func() { SignerClock = prevClock }()
+
+	inputData := []int{0, 1, 1, 2, 3, 5, 8}
+	var result []interface{}
+	start := time.Now()
+	ExecutePipeline(
+		sendInts(inputData...),
+		job(SingleHash),
+		job(MultiHash),
+		collect(&result),
+	)
+	realEnd := time.Since(start)
+
+	if len(result) != len(inputData) {
+		t.Fatalf("expected %d results, got %v", len(inputData), result)
+	}
+	// every item sleeps in crc32(data), md5, crc32(md5) and six crc32 of MultiHash,
+	// md5 is called one at a time, so OverheatLock never sleeps
+	perItem := 8*time.Second + 10*time.Millisecond
+	if elapsed, expected := clock.Now().Sub(begin), time.Duration(len(inputData))*perItem; elapsed != expected {
+		t.Errorf("wrong total time of sleeps\nGot: %s\nExpected: %s", elapsed, expected)
+	}
+	if n := clock.Sleeps(); n != 9*len(inputData) {
+		t.Errorf("expected %d sleeps, got %d", 9*len(inputData), n)
+	}
+	if realEnd > time.Second {
+		t.Errorf("fake clock should not sleep for real, took %s", realEnd)
+	}
+}
@@ -0,0 +1,10 @@
+module hw2_signer
+
+go 1.21
+
+require (
+	github.com/cespare/xxhash v1.1.0
+	golang.org/x/crypto v0.31.0
+)
+
+require golang.org/x/sys v0.28.0 // indirect
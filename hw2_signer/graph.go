@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Graph is a set of jobs connected into a DAG.
+// Stages are wired first and then started all together by Run.
+type Graph struct {
+	stages  []*Stage
+	runners []func()
+}
+
+// Stage is an output channel of a job or a combinator in the Graph.
+// Every stage can be consumed only once, use Tee to read it by several jobs.
+type Stage struct {
+	graph    *Graph
+	out      chan interface{}
+	consumed bool
+}
+
+// KeyValue is an item produced by Keyed jobs
+type KeyValue struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// NewGraph returns an empty Graph
+func NewGraph() *Graph {
+	return &Graph{}
+}
+
+func (g *Graph) newStage() *Stage {
+	s := &Stage{
+		graph: g,
+		out:   make(chan interface{}),
+	}
+	g.stages = append(g.stages, s)
+	return s
+}
+
+func (g *Graph) run(fn func()) {
+	g.runners = append(g.runners, fn)
+}
+
+// addJob runs j reading from in and writing into a new stage
+func (g *Graph) addJob(j job, in chan interface{}) *Stage {
+	s := g.newStage()
+	g.run(func() {
+		defer close(s.out)
+		j(in, s.out)
+	})
+	return s
+}
+
+func (s *Stage) consume() chan interface{} {
+	if s.consumed {
+		panic("stage is already consumed, use Tee to read it several times")
+	}
+	s.consumed = true
+	return s.out
+}
+
+// Source adds a job with a closed input
+func (g *Graph) Source(j job) *Stage {
+	in := make(chan interface{})
+	close(in)
+	return g.addJob(j, in)
+}
+
+// Then adds a job reading the stage
+func (s *Stage) Then(j job) *Stage {
+	return s.graph.addJob(j, s.consume())
+}
+
+// Tee broadcasts every item of the stage to n new stages.
+// The next item is sent only after all the stages have received the previous one.
+func (s *Stage) Tee(n int) []*Stage {
+	in := s.consume()
+
+	outs := make([]*Stage, n)
+	for i := range outs {
+		outs[i] = s.graph.newStage()
+	}
+
+	s.graph.run(func() {
+		defer func() {
+			for _, o := range outs {
+				close(o.out)
+			}
+		}()
+
+		wg := &sync.WaitGroup{}
+		for item := range in {
+			for _, o := range outs {
+				wg.Add(1)
+				go func(out chan interface{}) {
+					defer wg.Done()
+					out <- item
+				}(o.out)
+			}
+			wg.Wait()
+		}
+	})
+	return outs
+}
+
+// Merge combines items of several stages into one stage
+func (g *Graph) Merge(stages ...*Stage) *Stage {
+	ins := make([]chan interface{}, len(stages))
+	for i, s := range stages {
+		ins[i] = s.consume()
+	}
+
+	merged := g.newStage()
+	g.run(func() {
+		defer close(merged.out)
+
+		wg := &sync.WaitGroup{}
+		for _, in := range ins {
+			wg.Add(1)
+			go func(in chan interface{}) {
+				defer wg.Done()
+				for item := range in {
+					merged.out <- item
+				}
+			}(in)
+		}
+		wg.Wait()
+	})
+	return merged
+}
+
+// Split sends items matching pred into the first stage and the rest into the second one
+func (s *Stage) Split(pred func(item interface{}) bool) (*Stage, *Stage) {
+	in := s.consume()
+	matched, rest := s.graph.newStage(), s.graph.newStage()
+
+	s.graph.run(func() {
+		defer close(matched.out)
+		defer close(rest.out)
+
+		for item := range in {
+			if pred(item) {
+				matched.out <- item
+			} else {
+				rest.out <- item
+			}
+		}
+	})
+	return matched, rest
+}
+
+// Join pairs items of two stages having the same key and sends combine(left, right).
+// Items with equal keys are paired in order of arrival, items without a pair are dropped.
+func (g *Graph) Join(left, right *Stage, key func(item interface{}) interface{}, combine func(left, right interface{}) interface{}) *Stage {
+	leftIn, rightIn := left.consume(), right.consume()
+	joined := g.newStage()
+
+	g.run(func() {
+		defer close(joined.out)
+
+		leftWait := make(map[interface{}][]interface{})
+		rightWait := make(map[interface{}][]interface{})
+
+		// take the first waiting item with the key k from the queue
+		pop := func(queue map[interface{}][]interface{}, k interface{}) (interface{}, bool) {
+			items := queue[k]
+			if len(items) == 0 {
+				return nil, false
+			}
+			if len(items) == 1 {
+				delete(queue, k)
+			} else {
+				queue[k] = items[1:]
+			}
+			return items[0], true
+		}
+
+		for leftIn != nil || rightIn != nil {
+			select {
+			case item, ok := <-leftIn:
+				if !ok {
+					leftIn = nil
+					continue
+				}
+				k := key(item)
+				if pair, ok := pop(rightWait, k); ok {
+					joined.out <- combine(item, pair)
+				} else {
+					leftWait[k] = append(leftWait[k], item)
+				}
+			case item, ok := <-rightIn:
+				if !ok {
+					rightIn = nil
+					continue
+				}
+				k := key(item)
+				if pair, ok := pop(leftWait, k); ok {
+					joined.out <- combine(pair, item)
+				} else {
+					rightWait[k] = append(rightWait[k], item)
+				}
+			}
+		}
+	})
+	return joined
+}
+
+// Run starts all the jobs and waits for them.
+// Outputs of stages which are not read by anybody are discarded.
+func (g *Graph) Run() {
+	wg := &sync.WaitGroup{}
+
+	for _, s := range g.stages {
+		if s.consumed {
+			continue
+		}
+		wg.Add(1)
+		go func(out chan interface{}) {
+			defer wg.Done()
+			for range out {
+			}
+		}(s.out)
+	}
+
+	for _, runner := range g.runners {
+		wg.Add(1)
+		go func(runner func()) {
+			defer wg.Done()
+			runner()
+		}(runner)
+	}
+
+	wg.Wait()
+}
+
+// Keyed returns a job sending KeyValue{input, fn(input)} for every input item
+func Keyed(fn func(data string) string) job {
+	return func(in, out chan interface{}) {
+		wg := &sync.WaitGroup{}
+		defer wg.Wait()
+
+		for input := range in {
+			wg.Add(1)
+			go func(in interface{}) {
+				defer wg.Done()
+				out <- KeyValue{Key: in, Value: fn(fmt.Sprintf("%v", in))}
+			}(input)
+		}
+	}
+}
+
+// ByKey returns a key of KeyValue item, it is used with Join
+func ByKey(item interface{}) interface{} {
+	return item.(KeyValue).Key
+}
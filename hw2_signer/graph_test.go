@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func sendInts(data ...int) job {
+	return func(in, out chan interface{}) {
+		for _, i := range data {
+			out <- i
+		}
+	}
+}
+
+func collect(result *[]interface{}) job {
+	return func(in, out chan interface{}) {
+		for item := range in {
+			*result = append(*result, item)
+		}
+	}
+}
+
+func TestGraphTeeJoin(t *testing.T) {
+	s := NewSigner()
+	s.Checksum = XXHash
+	s.Digest = Sha256Hash
+
+	g := NewGraph()
+	branches := g.Source(sendInts(0, 1, 2, 3)).Tee(2)
+	single := branches[0].Then(Keyed(s.singleHash))
+	digest := branches[1].Then(Keyed(Sha256Hash))
+
+	var result []interface{}
+	g.Join(single, digest, ByKey, func(left, right interface{}) interface{} {
+		return KeyValue{
+			Key:   left.(KeyValue).Key,
+			Value: [2]interface{}{left.(KeyValue).Value, right.(KeyValue).Value},
+		}
+	}).Then(collect(&result))
+	g.Run()
+
+	if len(result) != 4 {
+		t.Fatalf("wrong number of results, expected 4, got %d", len(result))
+	}
+	for _, item := range result {
+		kv := item.(KeyValue)
+		data := kv.Key.(int)
+		pair := kv.Value.([2]interface{})
+		if expected := s.singleHash(strconv.Itoa(data)); pair[0] != expected {
+			t.Errorf("[%d] wrong SingleHash, expected %v, got %v", data, expected, pair[0])
+		}
+		if expected := Sha256Hash(strconv.Itoa(data)); pair[1] != expected {
+			t.Errorf("[%d] wrong digest, expected %v, got %v", data, expected, pair[1])
+		}
+	}
+}
+
+func TestGraphSplitMerge(t *testing.T) {
+	g := NewGraph()
+	even, odd := g.Source(sendInts(1, 2, 3, 4, 5, 6)).Split(func(item interface{}) bool {
+		return item.(int)%2 == 0
+	})
+	tenfold := odd.Then(func(in, out chan interface{}) {
+		for item := range in {
+			out <- item.(int) * 10
+		}
+	})
+
+	var result []interface{}
+	g.Merge(even, tenfold).Then(collect(&result))
+	g.Run()
+
+	got := make([]int, 0, len(result))
+	for _, item := range result {
+		got = append(got, item.(int))
+	}
+	sort.Ints(got)
+
+	expected := []int{2, 4, 6, 10, 30, 50}
+	if len(got) != len(expected) {
+		t.Fatalf("wrong result, expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("wrong result, expected %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestGraphUnconsumedStage(t *testing.T) {
+	g := NewGraph()
+	// nobody reads the second branch, Run must not hang
+	branches := g.Source(sendInts(1, 2, 3)).Tee(2)
+
+	var result []interface{}
+	branches[0].Then(collect(&result))
+	g.Run()
+
+	if len(result) != 3 {
+		t.Errorf("wrong number of results, expected 3, got %d", len(result))
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/cespare/xxhash"
+	"golang.org/x/crypto/blake2b"
+)
+
+// HashFunc calculates a hash of the given data and returns it as a string
+type HashFunc func(data string) string
+
+// Crc32Hash calls DataSignerCrc32. It is the default Signer checksum.
+func Crc32Hash(data string) string {
+	return DataSignerCrc32(data)
+}
+
+// Md5Hash calls DataSignerMd5 one at a time to avoid overheating.
+// It is the default Signer digest.
+func Md5Hash(data string) string {
+	return goDataSignerMd5(data)
+}
+
+// Sha256Hash returns hex encoded sha256 of the salted data
+func Sha256Hash(data string) string {
+	data += DataSignerSalt
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+}
+
+// XXHash returns decimal xxhash64 of the salted data
+func XXHash(data string) string {
+	data += DataSignerSalt
+	return strconv.FormatUint(xxhash.Sum64String(data), 10)
+}
+
+// Blake2bHash returns hex encoded blake2b-256 of the salted data
+func Blake2bHash(data string) string {
+	data += DataSignerSalt
+	return fmt.Sprintf("%x", blake2b.Sum256([]byte(data)))
+}
+
+var hashFuncs = map[string]HashFunc{
+	"crc32":   Crc32Hash,
+	"md5":     Md5Hash,
+	"sha256":  Sha256Hash,
+	"xxhash":  XXHash,
+	"blake2b": Blake2bHash,
+}
+
+// HashByName returns a HashFunc registered under the given name
+func HashByName(name string) (HashFunc, error) {
+	h, ok := hashFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown hash %q, available: %v", name, HashNames())
+	}
+	return h, nil
+}
+
+// HashNames returns sorted names of all available hashes
+func HashNames() []string {
+	names := make([]string, 0, len(hashFuncs))
+	for name := range hashFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/maxfer4maxfer/goDebuger"
+)
+
+// readItems returns a job sending every non empty line of given readers
+func readItems(readers []io.Reader, errs chan<- error) job {
+	return func(in, out chan interface{}) {
+		for _, r := range readers {
+			scanner := bufio.NewScanner(r)
+			for scanner.Scan() {
+				if line := scanner.Text(); line != "" {
+					out <- line
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}
+}
+
+// printResults returns a job printing every input item on a separate line
+func printResults(w io.Writer) job {
+	return func(in, out chan interface{}) {
+		for result := range in {
+			fmt.Fprintln(w, result)
+		}
+	}
+}
+
+// writeFile creates a file and writes into it with write
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// openInputs opens given files or returns stdin if there are no files
+func openInputs(paths []string) ([]io.Reader, func(), error) {
+	if len(paths) == 0 {
+		return []io.Reader{os.Stdin}, func() {}, nil
+	}
+
+	files := make([]*os.File, 0, len(paths))
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+
+	readers := make([]io.Reader, 0, len(paths))
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		files = append(files, f)
+		readers = append(readers, f)
+	}
+	return readers, closeAll, nil
+}
+
+func main() {
+	defer goDebuger.DebugTimeStamp(time.Now(), 0, "Main")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [file ...]\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Signs newline separated items from files or stdin.")
+		flag.PrintDefaults()
+	}
+	perLine := flag.Bool("per-line", false, "print a signature for every item instead of the combined one")
+	workers := flag.Int("workers", 0, "max items signed at once by each stage, 0 - unlimited")
+	salt := flag.String("salt", "", "value of DataSignerSalt")
+	checksum := flag.String("checksum", "crc32", fmt.Sprintf("checksum hash %v", HashNames()))
+	digest := flag.String("digest", "md5", fmt.Sprintf("digest hash %v", HashNames()))
+	checkpoint := flag.String("checkpoint", "", "file to save signed items to and resume from")
+	traceFile := flag.String("trace", "", "file to write an execution trace to, Chrome trace event format")
+	dotFile := flag.String("dot", "", "file to write the pipeline topology to, Graphviz DOT format")
+	flag.Parse()
+
+	DataSignerSalt = *salt
+
+	s := NewSigner()
+	s.MaxWorkers = *workers
+	var err error
+	if s.Checksum, err = HashByName(*checksum); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if s.Digest, err = HashByName(*digest); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err = s.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	readers, closeInputs, err := openInputs(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer closeInputs()
+
+	var store *CheckpointStore
+	if *checkpoint != "" {
+		config := fmt.Sprintf("checksum=%s digest=%s salt=%s multi=%d single=%q",
+			*checksum, *digest, *salt, s.MultiHashCount, s.SingleSeparator)
+		store, err = OpenCheckpointStore(*checkpoint, config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			closeInputs()
+			os.Exit(1)
+		}
+		defer store.Close()
+	}
+
+	errs := make(chan error, 1)
+	jobs := []job{readItems(readers, errs)}
+	switch {
+	case store != nil:
+		jobs = append(jobs, s.Checkpointed(store, s.Steps()...))
+	case *perLine:
+		jobs = append(jobs, s.SignEach)
+	default:
+		jobs = append(jobs, s.SingleHash, s.MultiHash)
+	}
+	// the combined signature is printed only after all input is read without errors
+	var combined string
+	if *perLine {
+		jobs = append(jobs, printResults(os.Stdout))
+	} else {
+		jobs = append(jobs, s.CombineResults, func(in, out chan interface{}) {
+			for result := range in {
+				combined = fmt.Sprintf("%v", result)
+			}
+		})
+	}
+
+	var tracer *Tracer
+	if *traceFile != "" || *dotFile != "" {
+		tracer = NewTracer()
+		s.Tracer = tracer
+	}
+
+	ExecutePipelineTraced(tracer, jobs...)
+
+	select {
+	case err = <-errs:
+	default:
+	}
+
+	// CombineResults of no items is empty, nothing is printed for empty input
+	if err == nil && combined != "" {
+		fmt.Println(combined)
+	}
+
+	if err == nil && *traceFile != "" {
+		err = writeFile(*traceFile, tracer.WriteChromeTrace)
+	}
+	if err == nil && *dotFile != "" {
+		err = writeFile(*dotFile, tracer.WriteDOT)
+	}
+
+	if err == nil && store != nil {
+		if storeErr := store.Err(); storeErr != nil {
+			err = fmt.Errorf("checkpoint is not saved: %s", storeErr)
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if store != nil {
+			store.Close()
+		}
+		closeInputs()
+		os.Exit(1)
+	}
+}
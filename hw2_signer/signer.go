@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"runtime"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -33,18 +35,21 @@ func ExecutePipeline(jobs ...job) {
 
 }
 
-func goDataSignerCrc32(in, out chan string) {
-	data := <-in
+// goHash calculates h(data) in a separate goroutine
+func goHash(h HashFunc, data string) chan string {
+	out := make(chan string, 1)
+	go func() {
+		defer goDebuger.DebugTimeStamp(time.Now(), 2, "goHash", data)
 
-	defer goDebuger.DebugTimeStamp(time.Now(), 2, "goDataSignerCrc32", data)
-
-	out <- DataSignerCrc32(data)
+		out <- h(data)
+	}()
+	return out
 }
 
-// we can only run a DataSignerCrc32 function one at the given moment
-// need to wait while a DataSignerCrc32 function is calculating
-// simaphor = 1 open -> can start DataSignerCrc32
-// simaphor = 0 open -> can't start DataSignerCrc32
+// we can only run a DataSignerMd5 function one at the given moment
+// need to wait while a DataSignerMd5 function is calculating
+// simaphor = 1 open -> can start DataSignerMd5
+// simaphor = 0 open -> can't start DataSignerMd5
 var simaphorGoDataSignerMd5 uint32 = 1
 
 func goDataSignerMd5(data string) string {
@@ -60,86 +65,178 @@ func goDataSignerMd5(data string) string {
 	}
 }
 
-// SingleHash Calculate
-func SingleHash(in, out chan interface{}) {
-	wg := &sync.WaitGroup{}
-	defer wg.Wait()
+// Signer describes a signing scheme:
+// SingleHash = Checksum(data) + SingleSeparator + Checksum(Digest(data))
+// MultiHash = Checksum(0+data) + ... + Checksum(MultiHashCount-1+data)
+// CombineResults = sorted results joined with CombineSeparator
+type Signer struct {
+	Checksum         HashFunc
+	Digest           HashFunc
+	MultiHashCount   int
+	SingleSeparator  string
+	CombineSeparator string
+	// MaxWorkers limits how many items each stage signs at once, 0 - unlimited
+	MaxWorkers int
+	// Tracer records spans of every item in every stage if it is set
+	Tracer *Tracer
+}
 
-	for input := range in {
-		wg.Add(1)
-		go func(wg *sync.WaitGroup, in interface{}, out chan interface{}) {
-			defer wg.Done()
-			data := fmt.Sprintf("%v", in)
+// NewSigner returns a Signer with the default scheme
+// crc32(data)~crc32(md5(data)), six crc32 in MultiHash and "_" in CombineResults
+func NewSigner() *Signer {
+	return &Signer{
+		Checksum:         Crc32Hash,
+		Digest:           Md5Hash,
+		MultiHashCount:   6,
+		SingleSeparator:  "~",
+		CombineSeparator: "_",
+	}
+}
 
-			defer goDebuger.DebugTimeStamp(time.Now(), 1, "SingleHash", data)
+// Validate reports settings the jobs of the Signer can't run with
+func (s *Signer) Validate() error {
+	switch {
+	case s.Checksum == nil || s.Digest == nil:
+		return errors.New("signer: Checksum and Digest must be set")
+	case s.MultiHashCount < 0:
+		return fmt.Errorf("signer: negative MultiHashCount %d", s.MultiHashCount)
+	}
+	return nil
+}
 
-			md5Data := goDataSignerMd5(data)
+// Sign calculates MultiHash(SingleHash(data)) for a single item
+func (s *Signer) Sign(data string) string {
+	return s.multiHash(s.singleHash(data))
+}
 
-			// crc32Md5Data := DataSignerCrc32(md5Data)
-			crc32Md5DataIn := make(chan string)
-			crc32Md5DataOut := make(chan string)
-			go goDataSignerCrc32(crc32Md5DataIn, crc32Md5DataOut)
-			crc32Md5DataIn <- md5Data
+func (s *Signer) singleHash(data string) string {
+	defer goDebuger.DebugTimeStamp(time.Now(), 1, "SingleHash", data)
 
-			// crc32Data := DataSignerCrc32(data)
-			crc32DataIn := make(chan string)
-			crc32DataOut := make(chan string)
-			go goDataSignerCrc32(crc32DataIn, crc32DataOut)
-			crc32DataIn <- data
+	checksumData := goHash(s.Checksum, data)
+	checksumDigest := goHash(s.Checksum, s.Digest(data))
 
-			out <- <-crc32DataOut + "~" + <-crc32Md5DataOut
+	return <-checksumData + s.SingleSeparator + <-checksumDigest
+}
 
-		}(wg, input, out)
+func (s *Signer) multiHash(data string) string {
+	results := make([]string, s.MultiHashCount)
+
+	// Run calculation of all checksums at once
+	wg := &sync.WaitGroup{}
+	for th := range results {
+		wg.Add(1)
+		go func(th int) {
+			defer wg.Done()
+			results[th] = s.Checksum(strconv.Itoa(th) + data)
+		}(th)
 	}
+	wg.Wait()
+
+	return strings.Join(results, "")
 }
 
-type outChannel struct {
-	i      int
-	result string
+// semaphore returns a channel limiting number of running workers
+// or nil if there is no limit
+func (s *Signer) semaphore() chan struct{} {
+	if s.MaxWorkers <= 0 {
+		return nil
+	}
+	return make(chan struct{}, s.MaxWorkers)
 }
 
-// MultiHash Calculate
-func MultiHash(in, out chan interface{}) {
+// forEach runs fn for every input item in a separate goroutine
+// and waits for all of them
+func (s *Signer) forEach(in, out chan interface{}, stage string, fn func(data string) string) {
 	wg := &sync.WaitGroup{}
 	defer wg.Wait()
 
+	sem := s.semaphore()
+	workers := &lanes{}
 	for input := range in {
+		if sem != nil {
+			sem <- struct{}{}
+		}
 		wg.Add(1)
-		go func(wg *sync.WaitGroup, in interface{}, out chan interface{}) {
+		go func(in interface{}) {
 			defer wg.Done()
 			data := fmt.Sprintf("%v", in)
+			lane := workers.get()
+			end := s.Tracer.Span(stage, lane, data)
+			result := fn(data)
+			end()
+			workers.put(lane)
+			if sem != nil {
+				<-sem
+			}
+			out <- result
+		}(input)
+	}
+}
 
-			channel := make(chan outChannel)
+// maxPendingOrdered is how many finished results forEachOrdered can keep
+// while waiting for an earlier item
+const maxPendingOrdered = 1024
+
+// forEachOrdered works like forEach but sends results in the input order.
+// fn also gets a sequence number of the item.
+func (s *Signer) forEachOrdered(in, out chan interface{}, stage string, fn func(seq int, data string) string) {
+	// results are waited for in the same order as items were received
+	pending := make(chan chan string, maxPendingOrdered)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for result := range pending {
+			out <- <-result
+		}
+	}()
 
-			// Run calculation of CRC32 five times
-			for th := 0; th < 6; th++ {
-				go func(th int, data string, out chan outChannel) {
-					result := DataSignerCrc32(strconv.Itoa(th) + data)
-					out <- outChannel{th, result}
-				}(th, data, channel)
+	sem := s.semaphore()
+	workers := &lanes{}
+	seq := 0
+	for input := range in {
+		if sem != nil {
+			sem <- struct{}{}
+		}
+		result := make(chan string, 1)
+		pending <- result
+		go func(seq int, in interface{}) {
+			data := fmt.Sprintf("%v", in)
+			lane := workers.get()
+			end := s.Tracer.Span(stage, lane, data)
+			result <- fn(seq, data)
+			end()
+			workers.put(lane)
+			if sem != nil {
+				<-sem
 			}
+		}(seq, input)
+		seq++
+	}
+	close(pending)
+	<-done
+}
 
-			// Collecting results from 5 runned DataSignerCrc32
-			results := make(map[int]string)
-			for i := 0; i < 6; i++ {
-				c := <-channel
-				results[c.i] = c.result
-			}
-			close(channel)
+// SingleHash is a job calculating the first step of the signature for each input item
+func (s *Signer) SingleHash(in, out chan interface{}) {
+	s.forEach(in, out, "SingleHash", s.singleHash)
+}
 
-			// Combine results
-			result := ""
-			for i := 0; i < 6; i++ {
-				result = result + results[i]
-			}
+// MultiHash is a job calculating the second step of the signature for each input item
+func (s *Signer) MultiHash(in, out chan interface{}) {
+	s.forEach(in, out, "MultiHash", s.multiHash)
+}
 
-			out <- result
-		}(wg, input, out)
-	}
+// SignEach is a job calculating the whole signature for each input item.
+// Unlike SingleHash and MultiHash it keeps the input order.
+func (s *Signer) SignEach(in, out chan interface{}) {
+	s.forEachOrdered(in, out, "SignEach", func(seq int, data string) string {
+		return s.Sign(data)
+	})
 }
 
-// CombineResults combine given string from the channel. Using "_" as a separator.
-func CombineResults(in, out chan interface{}) {
+// CombineResults is a job combining all given results into a sorted string
+// joined by CombineSeparator
+func (s *Signer) CombineResults(in, out chan interface{}) {
 
 	// get all results from the input channel
 	var r []string
@@ -147,49 +244,22 @@ func CombineResults(in, out chan interface{}) {
 		r = append(r, fmt.Sprintf("%v", result))
 	}
 
-	// sort
-	sort.Slice(r, func(i, j int) bool {
-		return r[i] < r[j]
-	})
+	sort.Strings(r)
 
-	// combine to the final string
-	result := r[0]
-	for i := 1; i < len(r); i++ {
-		result = result + "_" + r[i]
-	}
-	out <- result
+	out <- strings.Join(r, s.CombineSeparator)
 }
 
-func main() {
-
-	defer goDebuger.DebugTimeStamp(time.Now(), 0, "Main")
-
-	// inputData := []int{0, 1}
-	inputData := []int{0, 1, 1, 2, 3, 5, 8}
-
-	testResult := ""
-
-	hashSignJobs := []job{
-		job(func(in, out chan interface{}) {
-			for _, fibNum := range inputData {
-				out <- fibNum
-			}
-		}),
-		job(SingleHash),
-		job(MultiHash),
-		job(CombineResults),
-		job(func(in, out chan interface{}) {
-			dataRaw := <-in
-			data, ok := dataRaw.(string)
-			if !ok {
-				fmt.Println("cant convert result data to string")
-			}
-			testResult = data
-		}),
-	}
+// SingleHash calculates crc32(data)~crc32(md5(data))
+func SingleHash(in, out chan interface{}) {
+	NewSigner().SingleHash(in, out)
+}
 
-	ExecutePipeline(hashSignJobs...)
+// MultiHash calculates concatenation of crc32(th+data) where th=0..5
+func MultiHash(in, out chan interface{}) {
+	NewSigner().MultiHash(in, out)
+}
 
-	fmt.Println("")
-	fmt.Println("Result =", testResult)
+// CombineResults combine given string from the channel. Using "_" as a separator.
+func CombineResults(in, out chan interface{}) {
+	NewSigner().CombineResults(in, out)
 }
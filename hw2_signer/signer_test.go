@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestSignerCustomScheme(t *testing.T) {
+	sha := func(data string) string {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+	}
+	blake := func(data string) string {
+		return fmt.Sprintf("%x", blake2b.Sum256([]byte(data)))
+	}
+
+	inputData := []string{"0", "1", "2"}
+
+	expected := make([]string, 0, len(inputData))
+	for _, data := range inputData {
+		single := sha(data) + "|" + sha(blake(data))
+		multi := ""
+		for th := 0; th < 2; th++ {
+			multi += sha(strconv.Itoa(th) + single)
+		}
+		expected = append(expected, multi)
+	}
+	sort.Strings(expected)
+
+	s := NewSigner()
+	s.Checksum = Sha256Hash
+	s.Digest = Blake2bHash
+	s.MultiHashCount = 2
+	s.SingleSeparator = "|"
+	s.CombineSeparator = ";"
+
+	result := ""
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, data := range inputData {
+				out <- data
+			}
+		}),
+		job(s.SingleHash),
+		job(s.MultiHash),
+		job(s.CombineResults),
+		job(func(in, out chan interface{}) {
+			result = (<-in).(string)
+		}),
+	)
+
+	if result != strings.Join(expected, ";") {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", result, strings.Join(expected, ";"))
+	}
+}
+
+func TestHashByName(t *testing.T) {
+	for _, name := range HashNames() {
+		if _, err := HashByName(name); err != nil {
+			t.Errorf("unexpected error for %s: %v", name, err)
+		}
+	}
+
+	h, err := HashByName("xxhash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h("data") != XXHash("data") {
+		t.Errorf("wrong hash returned for xxhash")
+	}
+
+	if _, err := HashByName("unknown"); err == nil {
+		t.Errorf("expected error for unknown hash")
+	}
+}
+
+func TestSignerValidate(t *testing.T) {
+	if err := NewSigner().Validate(); err != nil {
+		t.Errorf("unexpected error for the default signer: %v", err)
+	}
+
+	s := NewSigner()
+	s.MultiHashCount = -1
+	if err := s.Validate(); err == nil {
+		t.Errorf("expected error for negative MultiHashCount")
+	}
+	s = NewSigner()
+	s.Digest = nil
+	if err := s.Validate(); err == nil {
+		t.Errorf("expected error without Digest")
+	}
+}
+
+func TestSignEachKeepsOrder(t *testing.T) {
+	s := NewSigner()
+	s.Checksum = XXHash
+	s.Digest = Sha256Hash
+	s.MaxWorkers = 2
+
+	inputData := []string{"b", "a", "d", "c", "e"}
+	readers := []io.Reader{
+		strings.NewReader("b\na\n\nd\n"),
+		strings.NewReader("c\ne"),
+	}
+
+	var result []string
+	errs := make(chan error, 1)
+	ExecutePipeline(
+		readItems(readers, errs),
+		job(s.SignEach),
+		job(func(in, out chan interface{}) {
+			for sign := range in {
+				result = append(result, sign.(string))
+			}
+		}),
+	)
+
+	if len(result) != len(inputData) {
+		t.Fatalf("wrong number of signatures, expected %d, got %d", len(inputData), len(result))
+	}
+	for i, data := range inputData {
+		if expected := s.Sign(data); result[i] != expected {
+			t.Errorf("[%d] wrong signature for %s\nGot: %v\nExpected: %v", i, data, result[i], expected)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer records an execution trace of a single pipeline:
+// lifetime of every job, items passed between jobs and
+// spans of items processed by Signer stages
+type Tracer struct {
+	mu        sync.Mutex
+	start     time.Time
+	stages    []string
+	durations []time.Duration
+	items     []int
+	events    []TraceEvent
+}
+
+// TraceEvent is a span of work on a single item or of a whole job.
+// Instant events (items passed to the next job) have Start equal to End.
+// Lane 0 of a stage is the job itself, workers of the job have lanes from 1,
+// so a lane has one span at a time.
+type TraceEvent struct {
+	Category string
+	Stage    string
+	Item     string
+	Lane     int
+	Start    time.Time
+	End      time.Time
+}
+
+// NewTracer returns a Tracer counting time from now
+func NewTracer() *Tracer {
+	return &Tracer{start: time.Now()}
+}
+
+// lanes hands out lanes to workers of a stage,
+// a lane of a finished worker is given to the next one
+type lanes struct {
+	mu   sync.Mutex
+	free []int
+	next int
+}
+
+func (l *lanes) get() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n := len(l.free); n > 0 {
+		lane := l.free[n-1]
+		l.free = l.free[:n-1]
+		return lane
+	}
+	l.next++
+	return l.next
+}
+
+func (l *lanes) put(lane int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.free = append(l.free, lane)
+}
+
+func (t *Tracer) add(e TraceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, e)
+}
+
+// Span starts a span of the item in the lane of the stage and returns a function finishing it.
+// It is safe to call on a nil Tracer.
+func (t *Tracer) Span(stage string, lane int, item string) func() {
+	if t == nil {
+		return func() {}
+	}
+	e := TraceEvent{
+		Category: "item",
+		Stage:    stage,
+		Item:     item,
+		Lane:     lane,
+		Start:    time.Now(),
+	}
+	return func() {
+		e.End = time.Now()
+		t.add(e)
+	}
+}
+
+// Events returns recorded events sorted by start time
+func (t *Tracer) Events() []TraceEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	events := make([]TraceEvent, len(t.events))
+	copy(events, t.events)
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+	return events
+}
+
+// jobName returns a short name of the job function
+func jobName(j job) string {
+	name := runtime.FuncForPC(reflect.ValueOf(j).Pointer()).Name()
+	// main.(*Signer).SingleHash-fm -> SingleHash
+	name = strings.TrimSuffix(name, "-fm")
+	if i := strings.LastIndex(name, ")."); i >= 0 {
+		name = name[i+2:]
+	}
+	name = strings.TrimPrefix(name, "main.")
+	// readItems.func1 -> readItems, a job made by a constructor
+	if i := strings.LastIndex(name, ".func"); i > 0 && name[:i] != "main" {
+		name = name[:i]
+	}
+	return name
+}
+
+// jobSpan starts the span of the whole job and returns a function finishing it
+func (t *Tracer) jobSpan(stage int) func() {
+	span := TraceEvent{Category: "job", Stage: t.stages[stage], Start: time.Now()}
+	return func() {
+		span.End = time.Now()
+		t.add(span)
+
+		t.mu.Lock()
+		t.durations[stage] = span.End.Sub(span.Start)
+		t.mu.Unlock()
+	}
+}
+
+// ExecutePipelineTraced works like ExecutePipeline and records the execution into the tracer
+func ExecutePipelineTraced(t *Tracer, jobs ...job) {
+	if t == nil {
+		ExecutePipeline(jobs...)
+		return
+	}
+
+	t.mu.Lock()
+	t.stages = make([]string, len(jobs))
+	for i, j := range jobs {
+		t.stages[i] = jobName(j)
+	}
+	t.durations = make([]time.Duration, len(jobs))
+	t.items = make([]int, len(jobs))
+	t.mu.Unlock()
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	in := make(chan interface{})
+
+	for stage, jobItem := range jobs {
+		out := make(chan interface{})
+		relayed := make(chan interface{})
+
+		wg.Add(2)
+		go func(stage int, jobFunc job, in, out chan interface{}) {
+			defer wg.Done()
+			defer close(out)
+
+			// every job is a span in lane 0 of its stage
+			end := t.jobSpan(stage)
+			jobFunc(in, out)
+			end()
+		}(stage, jobItem, in, out)
+
+		// relay items to the next job and record them
+		go func(stage int, out, relayed chan interface{}) {
+			defer wg.Done()
+			defer close(relayed)
+
+			for item := range out {
+				now := time.Now()
+				t.add(TraceEvent{
+					Category: "pass",
+					Stage:    t.stages[stage],
+					Item:     fmt.Sprintf("%v", item),
+					Start:    now,
+					End:      now,
+				})
+				t.mu.Lock()
+				t.items[stage]++
+				t.mu.Unlock()
+				relayed <- item
+			}
+		}(stage, out, relayed)
+
+		in = relayed
+	}
+}
+
+type chromeTraceEvent struct {
+	Name      string            `json:"name"`
+	Category  string            `json:"cat"`
+	Phase     string            `json:"ph"`
+	Timestamp float64           `json:"ts"`
+	Duration  float64           `json:"dur,omitempty"`
+	Scope     string            `json:"s,omitempty"`
+	PID       int               `json:"pid"`
+	TID       int               `json:"tid"`
+	Args      map[string]string `json:"args,omitempty"`
+}
+
+// WriteChromeTrace writes events in the Chrome trace event format,
+// open it in chrome://tracing or https://ui.perfetto.dev
+func (t *Tracer) WriteChromeTrace(w io.Writer) error {
+	micros := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Microsecond)
+	}
+
+	// every lane of every stage is a thread of the trace
+	type laneKey struct {
+		stage string
+		lane  int
+	}
+	tids := make(map[laneKey]int)
+
+	events := t.Events()
+	chromeEvents := make([]chromeTraceEvent, 0, len(events))
+	for _, e := range events {
+		key := laneKey{e.Stage, e.Lane}
+		if _, ok := tids[key]; !ok {
+			tids[key] = len(tids) + 1
+		}
+		ce := chromeTraceEvent{
+			Name:      e.Stage,
+			Category:  e.Category,
+			Phase:     "X",
+			Timestamp: micros(e.Start.Sub(t.start)),
+			Duration:  micros(e.End.Sub(e.Start)),
+			PID:       1,
+			TID:       tids[key],
+		}
+		if e.Item != "" {
+			ce.Args = map[string]string{"item": e.Item}
+		}
+		switch e.Category {
+		case "pass":
+			ce.Phase, ce.Scope = "i", "t"
+		case "job":
+			// a job is a begin and an end event in its own lane,
+			// items passed by the job are instant events inside of them
+			begin, end := ce, ce
+			begin.Phase, begin.Duration = "B", 0
+			end.Phase, end.Duration, end.Timestamp = "E", 0, micros(e.End.Sub(t.start))
+			chromeEvents = append(chromeEvents, begin, end)
+			continue
+		}
+		chromeEvents = append(chromeEvents, ce)
+	}
+
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []chromeTraceEvent `json:"traceEvents"`
+		DisplayTimeUnit string             `json:"displayTimeUnit"`
+	}{chromeEvents, "ms"})
+}
+
+// WriteDOT writes the pipeline topology in the Graphviz DOT format.
+// Jobs are labeled with their duration and edges with the number of passed items.
+func (t *Tracer) WriteDOT(w io.Writer) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, "digraph pipeline {")
+	fmt.Fprintln(buf, "\trankdir=LR;")
+	fmt.Fprintln(buf, "\tnode [shape=box];")
+	for i, stage := range t.stages {
+		label := fmt.Sprintf("%s\n%s", stage, t.durations[i].Round(time.Millisecond))
+		fmt.Fprintf(buf, "\ts%d [label=%q];\n", i, label)
+	}
+	for i := 0; i+1 < len(t.stages); i++ {
+		fmt.Fprintf(buf, "\ts%d -> s%d [label=\"%d items\"];\n", i, i+1, t.items[i])
+	}
+	fmt.Fprintln(buf, "}")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
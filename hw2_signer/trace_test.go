@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestExecutePipelineTraced(t *testing.T) {
+	s := NewSigner()
+	s.Checksum = XXHash
+	s.Digest = Sha256Hash
+	s.Tracer = NewTracer()
+
+	var result []interface{}
+	ExecutePipelineTraced(s.Tracer,
+		sendInts(0, 1, 2),
+		job(s.SingleHash),
+		job(s.MultiHash),
+		collect(&result),
+	)
+
+	if len(result) != 3 {
+		t.Fatalf("wrong number of results, expected 3, got %d", len(result))
+	}
+
+	spans := make(map[string]int)
+	for _, e := range s.Tracer.Events() {
+		if e.Category == "item" {
+			spans[e.Stage]++
+			if e.Lane == 0 || e.End.Before(e.Start) {
+				t.Errorf("wrong span %+v", e)
+			}
+		}
+	}
+	if spans["SingleHash"] != 3 || spans["MultiHash"] != 3 {
+		t.Errorf("expected 3 spans for each stage, got %v", spans)
+	}
+
+	chrome := &bytes.Buffer{}
+	if err := s.Tracer.WriteChromeTrace(chrome); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	trace := struct {
+		TraceEvents []map[string]interface{} `json:"traceEvents"`
+	}{}
+	if err := json.Unmarshal(chrome.Bytes(), &trace); err != nil {
+		t.Fatalf("cant unpack chrome trace: %v", err)
+	}
+	// begin and end of 4 jobs, 3 items passed by each of 3 jobs, 6 item spans
+	if len(trace.TraceEvents) != 8+9+6 {
+		t.Errorf("wrong number of chrome trace events: %d", len(trace.TraceEvents))
+	}
+
+	phases := make(map[string]int)
+	for _, e := range trace.TraceEvents {
+		phases[e["ph"].(string)]++
+	}
+	if phases["B"] != 4 || phases["E"] != 4 {
+		t.Errorf("expected begin and end of every job, got %v", phases)
+	}
+
+	dot := &bytes.Buffer{}
+	if err := s.Tracer.WriteDOT(dot); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		"digraph pipeline {",
+		`s1 [label="SingleHash\n`,
+		`s2 [label="MultiHash\n`,
+		`s0 -> s1 [label="3 items"];`,
+		`s2 -> s3 [label="3 items"];`,
+	} {
+		if !strings.Contains(dot.String(), expected) {
+			t.Errorf("DOT output does not contain %q:\n%s", expected, dot.String())
+		}
+	}
+}
+
+func TestTracerLanes(t *testing.T) {
+	s := NewSigner()
+	s.Checksum = XXHash
+	s.Digest = Sha256Hash
+	s.MaxWorkers = 2
+	s.Tracer = NewTracer()
+
+	var result []interface{}
+	ExecutePipelineTraced(s.Tracer,
+		sendInts(0, 1, 2, 3, 4, 5),
+		job(s.SingleHash),
+		collect(&result),
+	)
+
+	// a lane of a finished worker is reused, so there are no more lanes than workers
+	for _, e := range s.Tracer.Events() {
+		switch {
+		case e.Category == "item" && (e.Lane < 1 || e.Lane > 2):
+			t.Errorf("item span out of worker lanes %+v", e)
+		case e.Category != "item" && e.Lane != 0:
+			t.Errorf("job event out of the job lane %+v", e)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// -----
+// go test -run BenchGuard -benchguard
+// go test -run BenchGuard -update-baseline
+
+var (
+	benchGuard     = flag.Bool("benchguard", false, "compare BenchmarkSlow and BenchmarkFast with the baseline")
+	updateBaseline = flag.Bool("update-baseline", false, "run the benchmarks and save them as the baseline")
+	baselinePath   = flag.String("baseline", "bench_baseline.json", "file with baseline benchmark results")
+	benchThreshold = flag.Float64("threshold", 0.2, "allowed regression of FastSearch, 0.2 is 20%")
+	benchSummary   = flag.String("bench-summary", "", "also write the markdown summary into the file")
+	benchRuns      = flag.Int("bench-runs", 5, "runs of each benchmark, the fastest one is compared")
+)
+
+// benchResult is a single benchmark as it is stored in the baseline
+type benchResult struct {
+	NsPerOp     int64 `json:"ns_per_op"`
+	BytesPerOp  int64 `json:"bytes_per_op"`
+	AllocsPerOp int64 `json:"allocs_per_op"`
+}
+
+type benchBaseline struct {
+	GoVersion string      `json:"go_version"`
+	GOOS      string      `json:"goos"`
+	GOARCH    string      `json:"goarch"`
+	Slow      benchResult `json:"slow"`
+	Fast      benchResult `json:"fast"`
+}
+
+func runBenchmark(fn func(b *testing.B)) benchResult {
+	r := testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		fn(b)
+	})
+	return benchResult{
+		NsPerOp:     r.NsPerOp(),
+		BytesPerOp:  r.AllocedBytesPerOp(),
+		AllocsPerOp: r.AllocsPerOp(),
+	}
+}
+
+// minResult keeps the smallest value of every metric, noise only makes a run slower
+func minResult(a, b benchResult) benchResult {
+	min := func(x, y int64) int64 {
+		if x < y {
+			return x
+		}
+		return y
+	}
+	return benchResult{
+		NsPerOp:     min(a.NsPerOp, b.NsPerOp),
+		BytesPerOp:  min(a.BytesPerOp, b.BytesPerOp),
+		AllocsPerOp: min(a.AllocsPerOp, b.AllocsPerOp),
+	}
+}
+
+// runBenchmarks runs Slow and Fast by turns, so a busy machine slows down both of them,
+// and returns the best run of each
+func runBenchmarks(runs int) (slow, fast benchResult) {
+	for i := 0; i < runs; i++ {
+		s, f := runBenchmark(BenchmarkSlow), runBenchmark(BenchmarkFast)
+		if i == 0 {
+			slow, fast = s, f
+			continue
+		}
+		slow, fast = minResult(slow, s), minResult(fast, f)
+	}
+	return slow, fast
+}
+
+func benchChange(baseline, current int64) string {
+	if baseline == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", 100*(float64(current)/float64(baseline)-1))
+}
+
+// benchTable returns a markdown table comparing current results with the baseline
+func benchTable(baseline, current benchBaseline) string {
+	sb := &strings.Builder{}
+	sb.WriteString("| benchmark | metric | baseline | current | change |\n")
+	sb.WriteString("|---|---|---:|---:|---:|\n")
+	rows := []struct {
+		name              string
+		baseline, current benchResult
+	}{
+		{"Slow", baseline.Slow, current.Slow},
+		{"Fast", baseline.Fast, current.Fast},
+	}
+	for _, row := range rows {
+		metrics := []struct {
+			name              string
+			baseline, current int64
+		}{
+			{"ns/op", row.baseline.NsPerOp, row.current.NsPerOp},
+			{"B/op", row.baseline.BytesPerOp, row.current.BytesPerOp},
+			{"allocs/op", row.baseline.AllocsPerOp, row.current.AllocsPerOp},
+		}
+		for _, m := range metrics {
+			fmt.Fprintf(sb, "| %s | %s | %d | %d | %s |\n",
+				row.name, m.name, m.baseline, m.current, benchChange(m.baseline, m.current))
+		}
+	}
+	return sb.String()
+}
+
+// benchRegressions compares FastSearch with the baseline. Time depends on the machine,
+// so it is compared relative to SlowSearch, memory is compared as is.
+// Both times are the best of several runs, a single run is too noisy for the ratio.
+func benchRegressions(baseline, current benchBaseline, threshold float64) []string {
+	var result []string
+	worse := func(name string, baseline, current float64) {
+		if current > baseline*(1+threshold) {
+			result = append(result, fmt.Sprintf("Fast %s: %.4g, baseline %.4g", name, current, baseline))
+		}
+	}
+
+	ratio := func(r benchBaseline) float64 {
+		if r.Slow.NsPerOp == 0 {
+			return 0
+		}
+		return float64(r.Fast.NsPerOp) / float64(r.Slow.NsPerOp)
+	}
+	worse("ns/op relative to Slow", ratio(baseline), ratio(current))
+	worse("B/op", float64(baseline.Fast.BytesPerOp), float64(current.Fast.BytesPerOp))
+	worse("allocs/op", float64(baseline.Fast.AllocsPerOp), float64(current.Fast.AllocsPerOp))
+	return result
+}
+
+func TestBenchGuard(t *testing.T) {
+	if !*benchGuard && !*updateBaseline {
+		t.Skip("run with -benchguard or -update-baseline")
+	}
+
+	current := benchBaseline{
+		GoVersion: runtime.Version(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+	}
+	current.Slow, current.Fast = runBenchmarks(*benchRuns)
+
+	if *updateBaseline {
+		data, err := json.MarshalIndent(current, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(*baselinePath, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("baseline saved to %s", *baselinePath)
+		return
+	}
+
+	data, err := ioutil.ReadFile(*baselinePath)
+	if err != nil {
+		t.Fatalf("cant read baseline, create it with -update-baseline: %v", err)
+	}
+	baseline := benchBaseline{}
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		t.Fatalf("bad baseline %s: %v", *baselinePath, err)
+	}
+
+	table := benchTable(baseline, current)
+	t.Logf("baseline %s %s/%s, current %s %s/%s\n\n%s",
+		baseline.GoVersion, baseline.GOOS, baseline.GOARCH,
+		current.GoVersion, current.GOOS, current.GOARCH, table)
+	if *benchSummary != "" {
+		if err := ioutil.WriteFile(*benchSummary, []byte(table), 0644); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, r := range benchRegressions(baseline, current, *benchThreshold) {
+		t.Errorf("regression over %.0f%%: %s", *benchThreshold*100, r)
+	}
+}
+
+func TestBenchGuardRegressions(t *testing.T) {
+	baseline := benchBaseline{
+		Slow: benchResult{NsPerOp: 1000, BytesPerOp: 1000, AllocsPerOp: 100},
+		Fast: benchResult{NsPerOp: 100, BytesPerOp: 100, AllocsPerOp: 10},
+	}
+
+	// a twice slower machine is not a regression
+	current := baseline
+	current.Slow.NsPerOp, current.Fast.NsPerOp = 2000, 210
+	if r := benchRegressions(baseline, current, 0.2); len(r) != 0 {
+		t.Errorf("unexpected regressions: %v", r)
+	}
+
+	current.Fast.NsPerOp = 300
+	current.Fast.AllocsPerOp = 13
+	if r := benchRegressions(baseline, current, 0.2); len(r) != 2 {
+		t.Errorf("expected regressions in ns/op and allocs/op, got %v", r)
+	}
+
+	table := benchTable(baseline, current)
+	if !strings.Contains(table, "| Fast | allocs/op | 10 | 13 | +30.0% |") {
+		t.Errorf("unexpected summary:\n%s", table)
+	}
+}
+
+func TestBenchGuardMinResult(t *testing.T) {
+	a := benchResult{NsPerOp: 100, BytesPerOp: 20, AllocsPerOp: 3}
+	b := benchResult{NsPerOp: 90, BytesPerOp: 30, AllocsPerOp: 3}
+	if got := minResult(a, b); got != (benchResult{NsPerOp: 90, BytesPerOp: 20, AllocsPerOp: 3}) {
+		t.Errorf("unexpected min %+v", got)
+	}
+}
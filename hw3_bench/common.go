@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"os"
 	"regexp"
+	"sort"
 	"strings"
 	// "log"
 )
@@ -14,12 +14,27 @@ import (
 const filePath string = "./data/users.txt"
 
 func SlowSearch(out io.Writer) {
-	file, err := os.Open(filePath)
+	slowSearch(filePath, out, false)
+}
+
+// SlowSearchReader is SlowSearch reading users from in
+func SlowSearchReader(in io.Reader, out io.Writer) {
+	slowSearchReader(in, out, false)
+}
+
+// slowSearch is SlowSearch over any users file, it is used as a reference in tests.
+// The lenient mode skips malformed lines and lists them at the end like Searcher does.
+func slowSearch(path string, out io.Writer, lenient bool) {
+	file, err := OpenUsers(path)
 	if err != nil {
 		panic(err)
 	}
+	defer file.Close()
+	slowSearchReader(file, out, lenient)
+}
 
-	fileContents, err := ioutil.ReadAll(file)
+func slowSearchReader(in io.Reader, out io.Writer, lenient bool) {
+	fileContents, err := ioutil.ReadAll(in)
 	if err != nil {
 		panic(err)
 	}
@@ -28,14 +43,21 @@ func SlowSearch(out io.Writer) {
 	seenBrowsers := []string{}
 	uniqueBrowsers := 0
 	foundUsers := ""
+	malformed := []malformedLine{}
 
 	lines := strings.Split(string(fileContents), "\n")
 
 	users := make([]map[string]interface{}, 0)
-	for _, line := range lines {
+	for i, line := range lines {
 		user := make(map[string]interface{})
 		// fmt.Printf("%v %v\n", err, line)
 		err := json.Unmarshal([]byte(line), &user)
+		if err != nil && lenient {
+			// nil keeps indexes of the following users
+			malformed = append(malformed, malformedLine{line: i + 1, reason: err.Error()})
+			users = append(users, nil)
+			continue
+		}
 		if err != nil {
 			panic(err)
 		}
@@ -43,11 +65,18 @@ func SlowSearch(out io.Writer) {
 	}
 
 	for i, user := range users {
+		if user == nil {
+			continue
+		}
 
 		isAndroid := false
 		isMSIE := false
 
 		browsers, ok := user["browsers"].([]interface{})
+		if !ok && lenient {
+			malformed = append(malformed, malformedLine{line: i + 1, reason: errNoBrowsers.Error()})
+			continue
+		}
 		if !ok {
 			// log.Println("cant cast browsers")
 			continue
@@ -102,10 +131,22 @@ func SlowSearch(out io.Writer) {
 		}
 
 		// log.Println("Android and MSIE user:", user["name"], user["email"])
+		if _, ok := user["email"].(string); !ok && lenient {
+			malformed = append(malformed, malformedLine{line: i + 1, reason: errNoEmail.Error()})
+			continue
+		}
 		email := r.ReplaceAllString(user["email"].(string), " [at] ")
 		foundUsers += fmt.Sprintf("[%d] %s <%s>\n", i, user["name"], email)
 	}
 
 	fmt.Fprintln(out, "found users:\n"+foundUsers)
 	fmt.Fprintln(out, "Total unique browsers", len(seenBrowsers))
+
+	if len(malformed) > 0 {
+		sort.Slice(malformed, func(i, j int) bool {
+			return malformed[i].line < malformed[j].line
+		})
+		fmt.Fprintln(out)
+		writeMalformed(out, malformed)
+	}
 }
@@ -1,105 +1,176 @@
 package main
 
 import (
-	"encoding/json"
+	"bufio"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
-	"regexp"
-	"strings"
+	"strconv"
 )
 
 const filePathFast string = "./data/users.txt"
 
-// вам надо написать более быструю оптимальную этой функции
-func FastSearch(out io.Writer) {
-	file, err := os.Open(filePathFast)
-	if err != nil {
-		panic(err)
-	}
+// maxLineSize is the longest line of the users file we can read
+const maxLineSize = 1024 * 1024
 
-	fileContents, err := ioutil.ReadAll(file)
-	if err != nil {
-		panic(err)
-	}
-
-	seenBrowsers := []string{}
-	uniqueBrowsers := 0
-	foundUsers := ""
-
-	lines := strings.Split(string(fileContents), "\n")
+// userWriter is implemented by both bufio.Writer and bytes.Buffer
+type userWriter interface {
+	io.Writer
+	io.StringWriter
+	io.ByteWriter
+}
 
-	users := make([]map[string]interface{}, 0)
-	for _, line := range lines {
-		user := make(map[string]interface{})
-		// fmt.Printf("%v %v\n", err, line)
-		err := json.Unmarshal([]byte(line), &user)
-		if err != nil {
-			panic(err)
-		}
-		// fmt.Printf("%v\n", user)
-		users = append(users, user)
+// writeUser writes "[i] name <email>" masking the fields,
+// by default "@" in email is replaced with " [at] "
+func writeUser(w userWriter, i int, user *User, mask *Masking) {
+	var num [20]byte
+	w.WriteByte('[')
+	w.Write(strconv.AppendInt(num[:0], int64(i), 10))
+	w.WriteString("] ")
+	mask.write(w, mask.Name, fieldName, user.Name)
+	w.WriteString(" <")
+	mask.write(w, mask.Email, fieldEmail, user.Email)
+	w.WriteByte('>')
+	if mask.ShowPhone {
+		w.WriteByte(' ')
+		mask.write(w, mask.Phone, fieldPhone, user.Phone)
 	}
+	w.WriteByte('\n')
+}
 
-	for i, user := range users {
+// Searcher looks for users matching the query in the users file
+type Searcher struct {
+	Query Query
+	// Path is the users file for Search, filePathFast if empty.
+	// See OpenUsers for compressed files.
+	Path string
+	// Workers > 1 splits the file into chunks processed in parallel
+	Workers int
+	// ChunkSize is the size of chunks in the parallel mode, defaultChunkSize if zero
+	ChunkSize int
+	// Lenient skips malformed lines instead of failing on the first of them
+	Lenient bool
+	// Mask hides personal data of found users
+	Mask Masking
+	// Malformed gets the list of skipped lines in the lenient mode,
+	// if it is nil the list goes to the end of the search output
+	Malformed io.Writer
+}
 
-		isAndroid := false
-		isMSIE := false
+// malformedLine is a line skipped in the lenient mode
+type malformedLine struct {
+	// line is 1-based as in text editors
+	line   int
+	reason string
+}
 
-		browsers, ok := user["browsers"].([]interface{})
-		if !ok {
-			// log.Println("cant cast browsers")
-			continue
-		}
+// searchResult is what left after the found users are written
+type searchResult struct {
+	browsers  int
+	malformed []malformedLine
+}
 
-		for _, browserRaw := range browsers {
-			browser, ok := browserRaw.(string)
-			if !ok {
-				// log.Println("cant cast browser to string")
-				continue
-			}
+func (s *Searcher) open() (io.ReadCloser, error) {
+	if s.Path == "" {
+		return OpenUsers(filePathFast)
+	}
+	return OpenUsers(s.Path)
+}
 
-			browserFound := false
+// Search writes found users and the number of unique browsers into out
+func (s *Searcher) Search(out io.Writer) error {
+	file, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return s.SearchReader(file, out)
+}
 
-			if ok := strings.Contains(browser, "Android"); ok {
-				isAndroid = true
-				browserFound = true
-			}
+// SearchReader works like Search reading users from r instead of the file
+func (s *Searcher) SearchReader(r io.Reader, out io.Writer) error {
+	if err := s.Mask.Validate(); err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	w.WriteString("found users:\n")
+
+	var (
+		result searchResult
+		err    error
+	)
+	if s.Workers > 1 {
+		result, err = s.searchParallel(r, w)
+	} else {
+		result, err = s.searchSerial(r, w)
+	}
+	if err != nil {
+		return err
+	}
 
-			if ok := strings.Contains(browser, "MSIE"); ok {
-				isMSIE = true
-				browserFound = true
-			}
+	w.WriteString("\nTotal unique browsers ")
+	w.WriteString(strconv.Itoa(result.browsers))
+	w.WriteByte('\n')
 
-			if browserFound {
-				notSeenBefore := true
-				for _, item := range seenBrowsers {
-					if item == browser {
-						notSeenBefore = false
-					}
-				}
-				if notSeenBefore {
-					// log.Printf("SLOW New browser: %s, first seen: %s", browser, user["name"])
-					seenBrowsers = append(seenBrowsers, browser)
-					uniqueBrowsers++
-				}
+	if len(result.malformed) > 0 {
+		if s.Malformed != nil {
+			if err := writeMalformed(s.Malformed, result.malformed); err != nil {
+				return err
 			}
+		} else {
+			w.WriteByte('\n')
+			writeMalformed(w, result.malformed)
 		}
+	}
+	return w.Flush()
+}
 
-		// если у пользователя оба браузера то запоминаем его
-		if isAndroid && isMSIE {
-			// log.Println("Android and MSIE user:", user["name"], user["email"])
-			r := regexp.MustCompile("@")
-			email := r.ReplaceAllString(user["email"].(string), " [at] ")
-			foundUsers += fmt.Sprintf("[%d] %s <%s>\n", i, user["name"], email)
+// writeMalformed writes the number of skipped lines and the reasons
+func writeMalformed(w io.Writer, lines []malformedLine) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "Malformed lines %d\n", len(lines))
+	for _, l := range lines {
+		fmt.Fprintf(bw, "line %d: %s\n", l.line, l.reason)
+	}
+	return bw.Flush()
+}
+
+// searchSerial writes found users into w
+func (s *Searcher) searchSerial(r io.Reader, w userWriter) (searchResult, error) {
+	matcher := newUserMatcher(&s.Query, &s.Mask)
+	err := scanLines(r, func(i int, line []byte) error {
+		return matcher.matchLine(i, line, s.Lenient, w)
+	})
+	return searchResult{
+		browsers:  len(matcher.seenBrowsers),
+		malformed: matcher.malformed,
+	}, err
+}
+
+// scanLines calls fn for every line of r reusing the same buffer,
+// so the line is valid only until fn returns
+func scanLines(r io.Reader, fn func(i int, line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for i := 0; scanner.Scan(); i++ {
+		if err := fn(i, scanner.Bytes()); err != nil {
+			return err
 		}
 	}
+	return scanner.Err()
+}
 
-	fmt.Fprintln(out, "found users:\n"+foundUsers)
-	fmt.Fprintln(out, "Total unique browsers", len(seenBrowsers))
+// вам надо написать более быструю оптимальную этой функции
+func FastSearch(out io.Writer) {
+	s := Searcher{Query: DefaultQuery()}
+	if err := s.Search(out); err != nil {
+		panic(err)
+	}
 }
 
-func main() {
-	FastSearch(os.Stdout)
+// FastSearchReader is FastSearch reading users from in
+func FastSearchReader(in io.Reader, out io.Writer) {
+	s := Searcher{Query: DefaultQuery()}
+	if err := s.SearchReader(in, out); err != nil {
+		panic(err)
+	}
 }
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+)
+
+// GenConfig describes a synthetic users file
+type GenConfig struct {
+	// Seed makes the output reproducible, the same config gives the same file
+	Seed  int64
+	Users int
+	// every user gets from MinBrowsers to MaxBrowsers browsers
+	MinBrowsers int
+	MaxBrowsers int
+	// AndroidShare and MSIEShare are probabilities of a browser to be an Android or MSIE one
+	AndroidShare float64
+	MSIEShare    float64
+	// MalformedShare is a probability of a line to be broken
+	MalformedShare float64
+}
+
+// DefaultGenConfig is close to data/users.txt
+func DefaultGenConfig() GenConfig {
+	return GenConfig{
+		Seed:         1,
+		Users:        1000,
+		MinBrowsers:  4,
+		MaxBrowsers:  4,
+		AndroidShare: 0.13,
+		MSIEShare:    0.07,
+	}
+}
+
+func (cfg *GenConfig) validate() error {
+	switch {
+	case cfg.Users < 0:
+		return fmt.Errorf("negative number of users %d", cfg.Users)
+	case cfg.MinBrowsers < 0 || cfg.MaxBrowsers < cfg.MinBrowsers:
+		return fmt.Errorf("bad browsers range %d-%d", cfg.MinBrowsers, cfg.MaxBrowsers)
+	case cfg.AndroidShare < 0 || cfg.MSIEShare < 0 || cfg.AndroidShare+cfg.MSIEShare > 1:
+		return fmt.Errorf("bad shares of Android %v and MSIE %v", cfg.AndroidShare, cfg.MSIEShare)
+	case cfg.MalformedShare < 0 || cfg.MalformedShare > 1:
+		return fmt.Errorf("bad share of malformed lines %v", cfg.MalformedShare)
+	}
+	return nil
+}
+
+// agent templates, %d are replaced with random versions to get many unique agents
+var (
+	androidAgents = []string{
+		"Mozilla/5.0 (Linux; Android %d.%d; Nexus %d Build/KOT49H) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.%d.0 Mobile Safari/537.36",
+		"Mozilla/5.0 (Linux; U; Android %d.%d; en-us; GT-I%d Build/FROYO) AppleWebKit/533.1 (KHTML, like Gecko) Version/%d.0 Mobile Safari/%d.1",
+		"Mozilla/5.0 (Android %d.%d; Mobile; rv:%d.0) Gecko/%d.0 Firefox/%d.0",
+	}
+	msieAgents = []string{
+		"Mozilla/4.0 (compatible; MSIE %d.%d; Windows NT %d.1; Trident/%d.0; SLCC%d)",
+		"Mozilla/5.0 (compatible; MSIE %d.%d; Windows NT %d.0; WOW64; Trident/%d.0; .NET CLR %d.0)",
+	}
+	otherAgents = []string{
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.%d.%d.%d Safari/%d.36",
+		"Mozilla/5.0 (Windows NT %d.%d; rv:%d.0) Gecko/20100101 Firefox/%d.%d",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_%d_%d) AppleWebKit/%d.1 (KHTML, like Gecko) Version/%d.0 Safari/%d.1",
+		"Opera/9.%d (Windows NT %d.%d; U; en) Presto/2.%d.%d Version/11.1",
+		"Nokia%d/%d.0 (%d.%d) Profile/MIDP-%d.0 Configuration/CLDC-1.1",
+	}
+
+	firstNames = []string{"Alice", "Bob", "Carol", "Dave", "Eve", "Frank", "Grace", "Heidi", "Ivan", "Judy", "Mallory", "Oscar", "Peggy", "Trent", "Victor", "Walter"}
+	lastNames  = []string{"Smith", "Johnson", "Brown", "Taylor", "Miller", "Wilson", "Moore", "Anderson", "Thomas", "Jackson"}
+	companies  = []string{"Flashpoint", "Skinix", "Quatz", "Yodel", "Zoozzy", "Trudeo", "Livepath", "Jabbertype"}
+	countries  = []string{"Russia", "China", "Brazil", "Indonesia", "Portugal", "Poland", "France", "Sweden"}
+	jobs       = []string{"Programmer Analyst #{N}", "Web Designer #{N}", "Accountant #{N}", "Sales Representative", "Nurse"}
+	domains    = []string{"example.com", "example.org", "mail.example.net"}
+)
+
+// userGenerator makes random users with its own RNG
+type userGenerator struct {
+	cfg GenConfig
+	rnd *rand.Rand
+}
+
+func (g *userGenerator) pick(list []string) string {
+	return list[g.rnd.Intn(len(list))]
+}
+
+// agent fills %d of a random template from the list with small random numbers
+func (g *userGenerator) agent(list []string) string {
+	template := g.pick(list)
+	n := strings.Count(template, "%d")
+	args := make([]interface{}, n)
+	for i := range args {
+		args[i] = g.rnd.Intn(10)
+	}
+	return fmt.Sprintf(template, args...)
+}
+
+func (g *userGenerator) browser() string {
+	p := g.rnd.Float64()
+	switch {
+	case p < g.cfg.AndroidShare:
+		return g.agent(androidAgents)
+	case p < g.cfg.AndroidShare+g.cfg.MSIEShare:
+		return g.agent(msieAgents)
+	}
+	return g.agent(otherAgents)
+}
+
+func (g *userGenerator) user() *User {
+	first, last := g.pick(firstNames), g.pick(lastNames)
+	user := &User{
+		Name:    first + " " + last,
+		Email:   fmt.Sprintf("%s.%s%d@%s", strings.ToLower(first), strings.ToLower(last), g.rnd.Intn(100), g.pick(domains)),
+		Phone:   fmt.Sprintf("(%03d) %03d-%04d", g.rnd.Intn(1000), g.rnd.Intn(1000), g.rnd.Intn(10000)),
+		Company: g.pick(companies),
+		Country: g.pick(countries),
+		Job:     g.pick(jobs),
+	}
+	n := g.cfg.MinBrowsers + g.rnd.Intn(g.cfg.MaxBrowsers-g.cfg.MinBrowsers+1)
+	user.Browsers = make([]string, n)
+	for i := range user.Browsers {
+		user.Browsers[i] = g.browser()
+	}
+	return user
+}
+
+// malformed breaks a valid line in one of several ways
+func (g *userGenerator) malformed(line []byte) []byte {
+	switch g.rnd.Intn(4) {
+	case 0:
+		// truncated in the middle
+		return line[:g.rnd.Intn(len(line))]
+	case 1:
+		return []byte("this is not a json")
+	case 2:
+		// wrong type of browsers
+		return []byte(`{"browsers":"Android MSIE","email":"broken@example.com","name":"Broken"}`)
+	}
+	// unclosed string
+	return []byte(`{"browsers":["Android","MSIE],"name":"Broken"}`)
+}
+
+// GenerateUsers writes cfg.Users lines of users in the data/users.txt format.
+// As in data/users.txt the last line has no trailing newline.
+func GenerateUsers(out io.Writer, cfg GenConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	g := &userGenerator{cfg: cfg, rnd: rand.New(rand.NewSource(cfg.Seed))}
+	w := bufio.NewWriter(out)
+	for i := 0; i < cfg.Users; i++ {
+		line, err := json.Marshal(g.user())
+		if err != nil {
+			return err
+		}
+		if g.rnd.Float64() < cfg.MalformedShare {
+			line = g.malformed(line)
+		}
+
+		if i > 0 {
+			w.WriteByte('\n')
+		}
+		w.Write(line)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// generatedUsersFile writes generated users into a temporary file
+func generatedUsersFile(tb testing.TB, cfg GenConfig) string {
+	buf := &bytes.Buffer{}
+	if err := GenerateUsers(buf, cfg); err != nil {
+		tb.Fatal(err)
+	}
+	path := filepath.Join(tb.TempDir(), "users.txt")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+func TestGenerateUsers(t *testing.T) {
+	cfg := DefaultGenConfig()
+	cfg.Users = 5000
+	cfg.MinBrowsers, cfg.MaxBrowsers = 1, 6
+	cfg.AndroidShare, cfg.MSIEShare = 0.3, 0.2
+	cfg.MalformedShare = 0.1
+
+	out, again := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := GenerateUsers(out, cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	GenerateUsers(again, cfg)
+	if out.String() != again.String() {
+		t.Error("the same seed gave different users")
+	}
+
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) != cfg.Users {
+		t.Fatalf("got %d lines, expected %d", len(lines), cfg.Users)
+	}
+
+	malformed, browsers, android, msie := 0, 0, 0, 0
+	for _, line := range lines {
+		user := User{}
+		if err := json.Unmarshal([]byte(line), &user); err != nil {
+			malformed++
+			continue
+		}
+		if n := len(user.Browsers); n < cfg.MinBrowsers || n > cfg.MaxBrowsers {
+			t.Errorf("user has %d browsers: %s", n, line)
+		}
+		if !strings.Contains(user.Email, "@") {
+			t.Errorf("bad email: %s", line)
+		}
+		for _, browser := range user.Browsers {
+			browsers++
+			if strings.Contains(browser, "Android") {
+				android++
+			}
+			if strings.Contains(browser, "MSIE") {
+				msie++
+			}
+		}
+	}
+
+	near := func(name string, got, expected float64) {
+		if got < expected-0.03 || got > expected+0.03 {
+			t.Errorf("%s share %.3f, expected %.3f", name, got, expected)
+		}
+	}
+	near("malformed", float64(malformed)/float64(cfg.Users), cfg.MalformedShare)
+	near("Android", float64(android)/float64(browsers), cfg.AndroidShare)
+	near("MSIE", float64(msie)/float64(browsers), cfg.MSIEShare)
+
+	cfg.Seed++
+	other := &bytes.Buffer{}
+	GenerateUsers(other, cfg)
+	if other.String() == out.String() {
+		t.Error("different seeds gave the same users")
+	}
+}
+
+func TestGenerateUsersBadConfig(t *testing.T) {
+	configs := []GenConfig{
+		{Users: -1},
+		{Users: 1, MinBrowsers: 3, MaxBrowsers: 2},
+		{Users: 1, AndroidShare: 0.7, MSIEShare: 0.7},
+		{Users: 1, MalformedShare: 2},
+	}
+	for _, cfg := range configs {
+		if err := GenerateUsers(ioutil.Discard, cfg); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
+
+var datasetSizes = []int{100, 1000, 10000}
+
+func generatedDataset(tb testing.TB, users int) string {
+	cfg := DefaultGenConfig()
+	cfg.Users = users
+	return generatedUsersFile(tb, cfg)
+}
+
+func TestSearchGenerated(t *testing.T) {
+	for _, size := range datasetSizes {
+		path := generatedDataset(t, size)
+
+		slowOut := &bytes.Buffer{}
+		slowSearch(path, slowOut, false)
+		expected := slowOut.String()
+
+		for _, workers := range []int{1, 4} {
+			s := Searcher{Query: DefaultQuery(), Path: path, Workers: workers}
+			if result := searchString(t, s); result != expected {
+				t.Errorf("%d users, %d workers: results not match\nGot:\n%v\nExpected:\n%v",
+					size, workers, result, expected)
+			}
+		}
+	}
+}
+
+// -----
+// go test -bench Generated -benchmem
+
+func BenchmarkGenerated(b *testing.B) {
+	for _, size := range datasetSizes {
+		path := generatedDataset(b, size)
+
+		b.Run(fmt.Sprintf("Slow/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				slowSearch(path, ioutil.Discard, false)
+			}
+		})
+		b.Run(fmt.Sprintf("Fast/%d", size), func(b *testing.B) {
+			s := Searcher{Query: DefaultQuery(), Path: path}
+			for i := 0; i < b.N; i++ {
+				if err := s.Search(ioutil.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// stdinPath is the path meaning the standard input
+const stdinPath = "-"
+
+// OpenUsers opens a users file. Files ending in .gz and .zst are decompressed
+// on the fly, "-" is the standard input, which is not closed by Close.
+func OpenUsers(path string) (io.ReadCloser, error) {
+	var file io.ReadCloser
+	if path == stdinPath {
+		file = io.NopCloser(os.Stdin)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		file = f
+	}
+
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &decompressed{Reader: zr, closers: []io.Closer{zr, file}}, nil
+
+	case strings.HasSuffix(path, ".zst"):
+		// a single goroutine is enough, the search is slower than decompression
+		zr, err := zstd.NewReader(file, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &decompressed{Reader: zr, closers: []io.Closer{zr.IOReadCloser(), file}}, nil
+	}
+	return file, nil
+}
+
+// decompressed closes both the decompressor and the file
+type decompressed struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *decompressed) Close() error {
+	var err error
+	for _, c := range d.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressedUsersFile writes data/users.txt compressed by the writer made by compress
+func compressedUsersFile(t *testing.T, name string, compress func(w io.Writer) io.WriteCloser) string {
+	data, err := ioutil.ReadFile(filePathFast)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	zw := compress(buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSearchCompressed(t *testing.T) {
+	expected := searchString(t, Searcher{Query: DefaultQuery()})
+
+	paths := []string{
+		compressedUsersFile(t, "users.txt.gz", func(w io.Writer) io.WriteCloser {
+			return gzip.NewWriter(w)
+		}),
+		compressedUsersFile(t, "users.txt.zst", func(w io.Writer) io.WriteCloser {
+			zw, err := zstd.NewWriter(w)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return zw
+		}),
+	}
+
+	for _, path := range paths {
+		for _, workers := range []int{1, 4} {
+			s := Searcher{Query: DefaultQuery(), Path: path, Workers: workers}
+			if result := searchString(t, s); result != expected {
+				t.Errorf("%s, %d workers: results not match\nGot:\n%v\nExpected:\n%v", path, workers, result, expected)
+			}
+		}
+	}
+
+	// not compressed data with the compressed extension
+	s := Searcher{Query: DefaultQuery(), Path: filepath.Join(t.TempDir(), "users.txt.gz")}
+	ioutil.WriteFile(s.Path, []byte("{}"), 0644)
+	if err := s.Search(ioutil.Discard); err == nil {
+		t.Error("expected an error for broken gzip")
+	}
+}
+
+func TestSearchReader(t *testing.T) {
+	data, err := ioutil.ReadFile(filePathFast)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slowOut := &bytes.Buffer{}
+	SlowSearchReader(bytes.NewReader(data), slowOut)
+	fastOut := &bytes.Buffer{}
+	FastSearchReader(bytes.NewReader(data), fastOut)
+	if slowOut.String() != fastOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", fastOut.String(), slowOut.String())
+	}
+
+	s := Searcher{Query: DefaultQuery()}
+	report, err := s.ReportReader(bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Users != 1000 {
+		t.Errorf("expected 1000 users, got %d", report.Users)
+	}
+}
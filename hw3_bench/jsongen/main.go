@@ -0,0 +1,231 @@
+// jsongen generates reflection free JSON decoders for structs, like easyjson does.
+// The generated code uses jsonLexer which has to be in the same package.
+//
+//	go run ./jsongen -type User -output user_json.go user.go
+//
+// Keys are matched like encoding/json does: the exact name first, then case-insensitively.
+// A field tagged `json:"email,present"` also sets the unexported bool field hasEmail
+// when the key is decoded with a value other than null, so an empty value can be
+// told from a missing one. encoding/json ignores the option and the unexported
+// field, so otherwise both decoders give the same values.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// field is a struct field with a JSON name
+type field struct {
+	Name     string
+	JSONName string
+	// Type is string, int, bool or a slice of them
+	Type  string
+	Slice bool
+	// Present is the name of the bool field set when the field is decoded
+	Present string
+}
+
+var decoders = map[string]string{
+	"string": "l.string()",
+	"int":    "l.int()",
+	"bool":   "l.bool()",
+}
+
+func main() {
+	typeName := flag.String("type", "", "name of the struct type")
+	output := flag.String("output", "", "output file name, <file>_json.go by default")
+	flag.Parse()
+
+	if *typeName == "" || flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: jsongen -type Name [-output file] file.go")
+		os.Exit(2)
+	}
+	input := flag.Arg(0)
+	if *output == "" {
+		*output = strings.TrimSuffix(input, ".go") + "_json.go"
+	}
+
+	if err := generate(input, *typeName, *output); err != nil {
+		fmt.Fprintln(os.Stderr, "jsongen:", err)
+		os.Exit(1)
+	}
+}
+
+func generate(input, typeName, output string) error {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, input, nil, 0)
+	if err != nil {
+		return err
+	}
+
+	fields, err := structFields(file, typeName)
+	if err != nil {
+		return err
+	}
+
+	src, err := decoderSource(file.Name.Name, filepath.Base(input), typeName, fields)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(output, src, 0644)
+}
+
+// structFields finds the struct typeName and returns its exported fields
+func structFields(file *ast.File, typeName string) ([]field, error) {
+	var st *ast.StructType
+	ast.Inspect(file, func(n ast.Node) bool {
+		if ts, ok := n.(*ast.TypeSpec); ok && ts.Name.Name == typeName {
+			st, _ = ts.Type.(*ast.StructType)
+		}
+		return st == nil
+	})
+	if st == nil {
+		return nil, fmt.Errorf("struct %s is not found", typeName)
+	}
+
+	// unexported bool fields may be presence flags
+	flags := make(map[string]bool)
+	for _, f := range st.Fields.List {
+		if ident, ok := f.Type.(*ast.Ident); ok && ident.Name == "bool" {
+			for _, name := range f.Names {
+				flags[name.Name] = !name.IsExported()
+			}
+		}
+	}
+
+	fields := make([]field, 0, len(st.Fields.List))
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			return nil, fmt.Errorf("embedded fields are not supported")
+		}
+
+		typ, slice := f.Type, false
+		if arr, ok := typ.(*ast.ArrayType); ok && arr.Len == nil {
+			typ, slice = arr.Elt, true
+		}
+		ident, ok := typ.(*ast.Ident)
+		if !ok || decoders[ident.Name] == "" {
+			return nil, fmt.Errorf("field %s has unsupported type", f.Names[0].Name)
+		}
+
+		tag := ""
+		if f.Tag != nil {
+			tag = reflect.StructTag(strings.Trim(f.Tag.Value, "`")).Get("json")
+		}
+		options := strings.Split(tag, ",")
+		jsonName := options[0]
+		if jsonName == "-" {
+			continue
+		}
+		present := false
+		for _, option := range options[1:] {
+			present = present || option == "present"
+		}
+
+		for _, name := range f.Names {
+			if !name.IsExported() {
+				continue
+			}
+			fl := field{Name: name.Name, JSONName: jsonName, Type: ident.Name, Slice: slice}
+			if fl.JSONName == "" {
+				fl.JSONName = name.Name
+			}
+			if present {
+				fl.Present = "has" + name.Name
+				if !flags[fl.Present] {
+					return nil, fmt.Errorf("field %s needs unexported bool field %s", name.Name, fl.Present)
+				}
+			}
+			fields = append(fields, fl)
+		}
+	}
+	return fields, nil
+}
+
+// unexportedName lowercases the first letter of the name
+func unexportedName(name string) string {
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+func decoderSource(pkg, input, typeName string, fields []field) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	p := func(format string, args ...interface{}) {
+		fmt.Fprintf(buf, format+"\n", args...)
+	}
+
+	p("// Code generated by jsongen from %s; DO NOT EDIT.", input)
+	p("")
+	p("package %s", pkg)
+	p("")
+	keys := unexportedName(typeName) + "FastJSONKeys"
+	p("// %s are JSON names of %s fields", keys, typeName)
+	p("var %s = []string{", keys)
+	for _, f := range fields {
+		p("%q,", f.JSONName)
+	}
+	p("}")
+	p("")
+	p("// UnmarshalFastJSON decodes a JSON object into %s without reflection", typeName)
+	p("func (v *%s) UnmarshalFastJSON(data []byte) error {", typeName)
+	p("l := jsonLexer{data: data}")
+	p("v.decodeFastJSON(&l)")
+	p("l.end()")
+	p("return l.err")
+	p("}")
+	p("")
+	p("func (v *%s) decodeFastJSON(l *jsonLexer) {", typeName)
+	p("if l.null() {")
+	p("return")
+	p("}")
+	p("l.delim('{')")
+	p("for first := true; l.more('}', first); first = false {")
+	p("switch l.field(%s) {", keys)
+	for _, f := range fields {
+		p("case %q:", f.JSONName)
+		if !f.Slice {
+			p("if !l.null() {")
+			p("v.%s = %s", f.Name, decoders[f.Type])
+			if f.Present != "" {
+				p("v.%s = true", f.Present)
+			}
+			p("}")
+			continue
+		}
+		p("if l.null() {")
+		p("v.%s = nil", f.Name)
+		p("continue")
+		p("}")
+		if f.Present != "" {
+			p("v.%s = true", f.Present)
+		}
+		p("if v.%s == nil {", f.Name)
+		p("v.%s = []%s{}", f.Name, f.Type)
+		p("} else {")
+		p("v.%s = v.%s[:0]", f.Name, f.Name)
+		p("}")
+		p("l.delim('[')")
+		p("for first := true; l.more(']', first); first = false {")
+		p("v.%s = append(v.%s, %s)", f.Name, f.Name, decoders[f.Type])
+		p("}")
+		p("l.delim(']')")
+	}
+	p("default:")
+	p("l.skip()")
+	p("}")
+	p("}")
+	p("l.delim('}')")
+	p("}")
+
+	return format.Source(buf.Bytes())
+}
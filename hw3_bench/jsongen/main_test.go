@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// generated code in the parent package must be up to date
+func TestUserJSONIsUpToDate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsongen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "user_json.go")
+	if err := generate("../user.go", "User", output); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	generated, _ := ioutil.ReadFile(output)
+	committed, err := ioutil.ReadFile("../user_json.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(generated, committed) {
+		t.Errorf("user_json.go is outdated, run go generate")
+	}
+}
+
+func TestUnsupportedType(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsongen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "t.go")
+	ioutil.WriteFile(input, []byte("package p\ntype T struct{ M map[string]int }\n"), 0644)
+	if err := generate(input, "T", filepath.Join(dir, "t_json.go")); err == nil {
+		t.Errorf("expected error for map field")
+	}
+	if err := generate(input, "Missing", filepath.Join(dir, "t_json.go")); err == nil {
+		t.Errorf("expected error for missing type")
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// jsonLexer reads JSON tokens from a byte slice without reflection.
+// It is used by the code generated by jsongen.
+// The first error stops the lexer, all the following calls do nothing.
+type jsonLexer struct {
+	data []byte
+	pos  int
+	err  error
+	// buf keeps an unescaped string until the next call
+	buf     []byte
+	escaped bool
+	// aliasStrings makes string() return strings pointing into data instead of copies.
+	// Such strings are valid only while data is not changed, so it is set only
+	// for the time of userMatcher.view.
+	aliasStrings bool
+}
+
+// maxSkipDepth limits nesting of unknown values we skip
+const maxSkipDepth = 1000
+
+func (l *jsonLexer) reset(data []byte) {
+	l.data = data
+	l.pos = 0
+	l.err = nil
+}
+
+func (l *jsonLexer) fail(format string, args ...interface{}) {
+	if l.err == nil {
+		l.err = fmt.Errorf("json: "+format+" at offset %d", append(args, l.pos)...)
+	}
+}
+
+func (l *jsonLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch l.data[l.pos] {
+		case ' ', '\t', '\n', '\r':
+			l.pos++
+		default:
+			return
+		}
+	}
+}
+
+// peek returns the next non space byte or 0 at the end of data
+func (l *jsonLexer) peek() byte {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return 0
+	}
+	return l.data[l.pos]
+}
+
+// delim consumes the expected delimiter
+func (l *jsonLexer) delim(c byte) {
+	if l.err != nil {
+		return
+	}
+	if got := l.peek(); got != c {
+		l.unexpected(c)
+		return
+	}
+	l.pos++
+}
+
+func (l *jsonLexer) unexpected(expected byte) {
+	if l.pos >= len(l.data) {
+		l.fail("unexpected end of input, expecting %q", expected)
+		return
+	}
+	l.fail("unexpected %q, expecting %q", l.data[l.pos], expected)
+}
+
+// more consumes a comma between elements and reports whether
+// there is one more element before the closing delimiter end
+func (l *jsonLexer) more(end byte, first bool) bool {
+	if l.err != nil {
+		return false
+	}
+	c := l.peek()
+	if c == end {
+		return false
+	}
+	if first {
+		return true
+	}
+	if c != ',' {
+		l.unexpected(',')
+		return false
+	}
+	l.pos++
+	if l.peek() == end {
+		l.fail("unexpected %q after comma", end)
+		return false
+	}
+	return true
+}
+
+// null consumes null and reports whether it was there
+func (l *jsonLexer) null() bool {
+	if l.err != nil || l.peek() != 'n' {
+		return false
+	}
+	l.literal("null")
+	return l.err == nil
+}
+
+func (l *jsonLexer) literal(lit string) {
+	if len(l.data)-l.pos < len(lit) || string(l.data[l.pos:l.pos+len(lit)]) != lit {
+		l.fail("invalid literal, expecting %s", lit)
+		return
+	}
+	l.pos += len(lit)
+}
+
+// key reads an object key with the following colon.
+// The result is valid until the next call.
+func (l *jsonLexer) key() []byte {
+	key := l.rawString()
+	l.delim(':')
+	return key
+}
+
+// field reads an object key with the following colon and returns the name it matches.
+// Like encoding/json it prefers the exact match and then matches keys case-insensitively.
+// An unknown key gives "".
+func (l *jsonLexer) field(names []string) string {
+	key := l.key()
+	for _, name := range names {
+		if string(key) == name {
+			return name
+		}
+	}
+	for _, name := range names {
+		if bytes.EqualFold(key, []byte(name)) {
+			return name
+		}
+	}
+	return ""
+}
+
+// rawString reads a string and returns its unescaped bytes.
+// The result may point into data or into buf and is valid until the next call.
+func (l *jsonLexer) rawString() []byte {
+	if l.err != nil {
+		return nil
+	}
+	if l.peek() != '"' {
+		l.unexpected('"')
+		return nil
+	}
+	l.pos++
+	l.escaped = false
+
+	start := l.pos
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case c == '"':
+			l.pos++
+			return l.data[start : l.pos-1]
+		case c == '\\':
+			return l.escapedString(start)
+		case c < 0x20:
+			l.fail("invalid character %q in string", c)
+			return nil
+		default:
+			l.pos++
+		}
+	}
+	l.fail("unexpected end of input in string")
+	return nil
+}
+
+// escapedString continues reading a string from the first backslash
+func (l *jsonLexer) escapedString(start int) []byte {
+	l.escaped = true
+	l.buf = append(l.buf[:0], l.data[start:l.pos]...)
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return l.buf
+		case c < 0x20:
+			l.fail("invalid character %q in string", c)
+			return nil
+		case c != '\\':
+			l.buf = append(l.buf, c)
+			l.pos++
+			continue
+		}
+
+		l.pos++
+		if l.pos >= len(l.data) {
+			break
+		}
+		switch esc := l.data[l.pos]; esc {
+		case '"', '\\', '/':
+			l.buf = append(l.buf, esc)
+		case 'b':
+			l.buf = append(l.buf, '\b')
+		case 'f':
+			l.buf = append(l.buf, '\f')
+		case 'n':
+			l.buf = append(l.buf, '\n')
+		case 'r':
+			l.buf = append(l.buf, '\r')
+		case 't':
+			l.buf = append(l.buf, '\t')
+		case 'u':
+			r := l.hex4()
+			if utf16.IsSurrogate(r) {
+				// the second half of a surrogate pair must follow
+				r2 := utf8.RuneError
+				if l.pos+2 < len(l.data) && l.data[l.pos+1] == '\\' && l.data[l.pos+2] == 'u' {
+					l.pos += 2
+					r2 = l.hex4()
+				}
+				r = utf16.DecodeRune(r, r2)
+			}
+			if l.err != nil {
+				return nil
+			}
+			l.buf = utf8.AppendRune(l.buf, r)
+		default:
+			l.fail("invalid escape %q in string", esc)
+			return nil
+		}
+		l.pos++
+	}
+	l.fail("unexpected end of input in string")
+	return nil
+}
+
+// hex4 reads XXXX of \uXXXX, pos points to 'u' and is left on the last digit
+func (l *jsonLexer) hex4() rune {
+	if l.pos+4 >= len(l.data) {
+		l.fail("unexpected end of input in string")
+		return utf8.RuneError
+	}
+	var r rune
+	for _, c := range l.data[l.pos+1 : l.pos+5] {
+		switch {
+		case '0' <= c && c <= '9':
+			c -= '0'
+		case 'a' <= c && c <= 'f':
+			c = c - 'a' + 10
+		case 'A' <= c && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			l.fail("invalid unicode escape in string")
+			return utf8.RuneError
+		}
+		r = r<<4 | rune(c)
+	}
+	l.pos += 4
+	return r
+}
+
+// string reads a string value, it is a copy unless aliasStrings is set
+func (l *jsonLexer) string() string {
+	b := l.rawString()
+	if l.aliasStrings && !l.escaped && len(b) > 0 {
+		return unsafe.String(&b[0], len(b))
+	}
+	return string(b)
+}
+
+// number reads bytes of a number
+func (l *jsonLexer) number() []byte {
+	if l.err != nil {
+		return nil
+	}
+	l.skipSpace()
+	start := l.pos
+	if l.pos < len(l.data) && l.data[l.pos] == '-' {
+		l.pos++
+	}
+	digits := func() int {
+		n := 0
+		for l.pos < len(l.data) && '0' <= l.data[l.pos] && l.data[l.pos] <= '9' {
+			l.pos++
+			n++
+		}
+		return n
+	}
+	if digits() == 0 {
+		l.fail("invalid number")
+		return nil
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '.' {
+		l.pos++
+		if digits() == 0 {
+			l.fail("invalid number")
+			return nil
+		}
+	}
+	if l.pos < len(l.data) && (l.data[l.pos] == 'e' || l.data[l.pos] == 'E') {
+		l.pos++
+		if l.pos < len(l.data) && (l.data[l.pos] == '+' || l.data[l.pos] == '-') {
+			l.pos++
+		}
+		if digits() == 0 {
+			l.fail("invalid number")
+			return nil
+		}
+	}
+	return l.data[start:l.pos]
+}
+
+// int reads an integer value
+func (l *jsonLexer) int() int {
+	num := l.number()
+	if l.err != nil {
+		return 0
+	}
+	n, err := strconv.Atoi(string(num))
+	if err != nil {
+		l.fail("cant use %s as int", num)
+	}
+	return n
+}
+
+// bool reads true or false
+func (l *jsonLexer) bool() bool {
+	if l.err != nil {
+		return false
+	}
+	switch l.peek() {
+	case 't':
+		l.literal("true")
+		return true
+	case 'f':
+		l.literal("false")
+	default:
+		l.fail("invalid bool")
+	}
+	return false
+}
+
+// skip reads any value and throws it away
+func (l *jsonLexer) skip() {
+	l.skipDepth(0)
+}
+
+func (l *jsonLexer) skipDepth(depth int) {
+	if depth > maxSkipDepth {
+		l.fail("too deep nesting")
+		return
+	}
+	switch l.peek() {
+	case '{':
+		l.pos++
+		for first := true; l.more('}', first); first = false {
+			l.key()
+			l.skipDepth(depth + 1)
+		}
+		l.delim('}')
+	case '[':
+		l.pos++
+		for first := true; l.more(']', first); first = false {
+			l.skipDepth(depth + 1)
+		}
+		l.delim(']')
+	case '"':
+		l.rawString()
+	case 't', 'f':
+		l.bool()
+	case 'n':
+		l.null()
+	default:
+		l.number()
+	}
+}
+
+// end checks there is nothing but spaces left
+func (l *jsonLexer) end() {
+	if l.err == nil && l.peek() != 0 {
+		l.fail("unexpected %q after top-level value", l.data[l.pos])
+	}
+}
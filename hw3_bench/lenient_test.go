@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLenientSearch(t *testing.T) {
+	cfg := DefaultGenConfig()
+	cfg.Users = 2000
+	cfg.MalformedShare = 0.05
+	path := generatedUsersFile(t, cfg)
+
+	slowOut := &bytes.Buffer{}
+	slowSearch(path, slowOut, true)
+	expected := slowOut.String()
+	if !strings.Contains(expected, "Malformed lines") {
+		t.Fatalf("no malformed lines generated:\n%s", expected)
+	}
+
+	for _, workers := range []int{1, 4} {
+		s := Searcher{Query: DefaultQuery(), Path: path, Workers: workers, ChunkSize: 4096, Lenient: true}
+		result := searchString(t, s)
+
+		// reasons are given by different JSON decoders, so only line numbers are compared
+		if stripReasons(result) != stripReasons(expected) {
+			t.Errorf("%d workers: results not match\nGot:\n%v\nExpected:\n%v", workers, result, expected)
+		}
+
+		strict := Searcher{Query: DefaultQuery(), Path: path, Workers: workers}
+		if err := strict.Search(ioutil.Discard); err == nil || !strings.HasPrefix(err.Error(), "line ") {
+			t.Errorf("%d workers: expected an error with a line number, got %v", workers, err)
+		}
+	}
+}
+
+// stripReasons cuts reasons off the "line N: reason" lines
+func stripReasons(out string) string {
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "line ") {
+			lines[i] = line[:strings.Index(line, ":")]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestLenientMissingEmail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	data := strings.Join([]string{
+		`{"browsers":["Android 4","MSIE 8"],"name":"Ann","email":"ann@example.com"}`,
+		`{"browsers":["Android 5","MSIE 9"],"name":"Bob"}`,
+		`{"browsers":["Android 6"],"name":"Kate"`,
+		`{"browsers":["Android 7","MSIE 10"],"name":"Max","email":"max@example.com"}`,
+	}, "\n")
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	malformed := &bytes.Buffer{}
+	s := Searcher{Query: DefaultQuery(), Path: path, Lenient: true, Malformed: malformed}
+	result := searchString(t, s)
+
+	expected := "found users:\n" +
+		"[0] Ann <ann [at] example.com>\n" +
+		"[3] Max <max [at] example.com>\n" +
+		"\nTotal unique browsers 6\n"
+	if result != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", result, expected)
+	}
+	if !strings.HasPrefix(malformed.String(), "Malformed lines 2\nline 2: missing email\nline 3: ") {
+		t.Errorf("unexpected malformed lines:\n%s", malformed.String())
+	}
+
+	report, err := s.Report(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Users != 3 || report.Malformed != 1 {
+		t.Errorf("expected 3 users and 1 malformed line, got %+v", report)
+	}
+}
+
+func TestLenientMissingBrowsers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	data := strings.Join([]string{
+		`{"browsers":["Android 4","MSIE 8"],"name":"Ann","email":"ann@example.com"}`,
+		`{"name":"Bob","email":"bob@example.com"}`,
+		`{"browsers":["Android 5","MSIE 9"],"name":"Kate","email":""}`,
+		`{"browsers":null,"name":"Max","email":"max@example.com"}`,
+	}, "\n")
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// an empty email is present, so the user is found as SlowSearch finds it
+	slowOut := &bytes.Buffer{}
+	slowSearch(path, slowOut, false)
+	expected := "found users:\n" +
+		"[0] Ann <ann [at] example.com>\n" +
+		"[2] Kate <>\n" +
+		"\nTotal unique browsers 4\n"
+	if slowOut.String() != expected {
+		t.Fatalf("slow search got:\n%s\nexpected:\n%s", slowOut.String(), expected)
+	}
+	if result := searchString(t, Searcher{Query: DefaultQuery(), Path: path}); result != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", result, expected)
+	}
+
+	// users without browsers are skipped silently by the strict search and reported by the lenient one
+	slowOut.Reset()
+	slowSearch(path, slowOut, true)
+	if !strings.Contains(slowOut.String(), "Malformed lines 2\nline 2: browsers is not a list\nline 4: browsers is not a list\n") {
+		t.Fatalf("unexpected slow lenient output:\n%s", slowOut.String())
+	}
+	result := searchString(t, Searcher{Query: DefaultQuery(), Path: path, Lenient: true})
+	if result != slowOut.String() {
+		t.Errorf("got:\n%s\nexpected:\n%s", result, slowOut.String())
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// listFlag is a comma separated list which can be given several times
+type listFlag struct {
+	values []string
+	set    bool
+}
+
+func (f *listFlag) String() string {
+	return strings.Join(f.values, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	f.set = true
+	for _, v := range strings.Split(value, ",") {
+		if v != "" {
+			f.values = append(f.values, v)
+		}
+	}
+	return nil
+}
+
+func main() {
+	q := DefaultQuery()
+	require := &listFlag{}
+	forbid := &listFlag{}
+
+	flag.Var(require, "require", "browser substrings a user must have, comma separated (default Android,MSIE)")
+	flag.Var(forbid, "forbid", "browser substrings a user must not have, comma separated")
+	flag.StringVar(&q.Country, "country", "", "only users from the country")
+	flag.StringVar(&q.Company, "company", "", "only users from the company")
+	flag.StringVar(&q.Job, "job", "", "only users with the job")
+	workers := flag.Int("workers", runtime.GOMAXPROCS(0), "number of goroutines matching users")
+	report := flag.Bool("report", false, "print browsers report instead of users")
+	top := flag.Int("top", 10, "rows in every table of the report, 0 for all")
+	format := flag.String("format", "text", "report format: text, json or csv")
+	lenient := flag.Bool("lenient", false, "skip malformed lines and list them in stderr")
+	mask := Masking{}
+	allMask := MaskDefault
+	flag.Var(&allMask, "mask", "mask policy of all personal fields: default, keep, redact, hash or partial")
+	flag.Var(&mask.Name, "mask-name", "mask policy of names, overrides -mask")
+	flag.Var(&mask.Email, "mask-email", "mask policy of emails, overrides -mask")
+	flag.Var(&mask.Phone, "mask-phone", "mask policy of phones, overrides -mask")
+	flag.BoolVar(&mask.ShowPhone, "phone", false, "show phones of found users")
+	flag.StringVar(&mask.Salt, "mask-salt", "", "secret key of hashed fields, required by the hash policy")
+	generate := flag.Bool("generate", false, "write synthetic users to stdout instead of searching")
+	gen := DefaultGenConfig()
+	flag.Int64Var(&gen.Seed, "seed", gen.Seed, "seed of generated users")
+	flag.IntVar(&gen.Users, "users", gen.Users, "number of generated users")
+	flag.IntVar(&gen.MinBrowsers, "min-browsers", gen.MinBrowsers, "min browsers of a generated user")
+	flag.IntVar(&gen.MaxBrowsers, "max-browsers", gen.MaxBrowsers, "max browsers of a generated user")
+	flag.Float64Var(&gen.AndroidShare, "android", gen.AndroidShare, "share of generated Android browsers")
+	flag.Float64Var(&gen.MSIEShare, "msie", gen.MSIEShare, "share of generated MSIE browsers")
+	flag.Float64Var(&gen.MalformedShare, "malformed", gen.MalformedShare, "share of generated malformed lines")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [file ...]\n\n"+
+			"Files ending in .gz and .zst are decompressed, - is the standard input,\n"+
+			"%s is used without files.\n\n", os.Args[0], filePathFast)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if require.set {
+		q.Require = require.values
+	}
+	q.Forbid = forbid.values
+
+	// -mask applies to the fields without their own policy
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	for name, policy := range map[string]*MaskPolicy{
+		"mask-name":  &mask.Name,
+		"mask-email": &mask.Email,
+		"mask-phone": &mask.Phone,
+	} {
+		if !explicit[name] {
+			*policy = allMask
+		}
+	}
+	if err := mask.Validate(); err != nil {
+		fail(err)
+	}
+
+	if *generate {
+		if err := GenerateUsers(os.Stdout, gen); err != nil {
+			fail(err)
+		}
+		return
+	}
+
+	paths := flag.Args()
+	if len(paths) == 0 {
+		paths = []string{filePathFast}
+	}
+	for i, path := range paths {
+		if len(paths) > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("==> %s <==\n", path)
+		}
+
+		s := Searcher{Query: q, Path: path, Workers: *workers, Lenient: *lenient, Mask: mask, Malformed: os.Stderr}
+		var err error
+		if *report {
+			err = writeReport(&s, *top, *format)
+		} else {
+			err = s.Search(os.Stdout)
+		}
+		if err != nil {
+			fail(fmt.Errorf("%s: %w", path, err))
+		}
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func writeReport(s *Searcher, top int, format string) error {
+	report, err := s.Report(top)
+	if err != nil {
+		return err
+	}
+	return report.Write(os.Stdout, format)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaskPolicy is how a personal field of a found user is shown
+type MaskPolicy int
+
+const (
+	// MaskDefault replaces "@" in emails with " [at] " and keeps other fields
+	MaskDefault MaskPolicy = iota
+	// MaskKeep shows the value as is
+	MaskKeep
+	// MaskRedact hides the value completely
+	MaskRedact
+	// MaskHash shows a short HMAC-SHA256 of the value keyed by Masking.Salt,
+	// so the same person can be found in several reports
+	MaskHash
+	// MaskPartial keeps only first letters: j***@domain, J*** S***, ***-**-49
+	MaskPartial
+)
+
+var maskPolicyNames = []string{"default", "keep", "redact", "hash", "partial"}
+
+func (p MaskPolicy) String() string {
+	if p < 0 || int(p) >= len(maskPolicyNames) {
+		return fmt.Sprintf("MaskPolicy(%d)", int(p))
+	}
+	return maskPolicyNames[p]
+}
+
+// ParseMaskPolicy returns the policy by its name
+func ParseMaskPolicy(name string) (MaskPolicy, error) {
+	for i, n := range maskPolicyNames {
+		if n == name {
+			return MaskPolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown mask policy %q, expecting one of %s", name, strings.Join(maskPolicyNames, ", "))
+}
+
+// Set parses the policy name, so the policy can be a command-line flag
+func (p *MaskPolicy) Set(name string) error {
+	policy, err := ParseMaskPolicy(name)
+	if err != nil {
+		return err
+	}
+	*p = policy
+	return nil
+}
+
+// Masking chooses policies for personal fields of found users.
+// The zero value gives the original output.
+type Masking struct {
+	Name  MaskPolicy
+	Email MaskPolicy
+	Phone MaskPolicy
+	// ShowPhone adds the phone after the email
+	ShowPhone bool
+	// Salt is the secret key of MaskHash, so hashes can't be reversed
+	// by hashing known emails. MaskHash can't be used without it.
+	Salt string
+}
+
+// ErrNoMaskSalt is returned for MaskHash without Masking.Salt
+var ErrNoMaskSalt = errors.New("mask policy hash needs a salt")
+
+// Validate checks the policies can be applied
+func (m *Masking) Validate() error {
+	for _, policy := range []MaskPolicy{m.Name, m.Email, m.Phone} {
+		if policy == MaskHash && m.Salt == "" {
+			return ErrNoMaskSalt
+		}
+	}
+	return nil
+}
+
+// redacted replaces a value hidden by MaskRedact
+const redacted = "[redacted]"
+
+// hashLen is the number of hex digits shown by MaskHash
+const hashLen = 12
+
+type maskField int
+
+const (
+	fieldName maskField = iota
+	fieldEmail
+	fieldPhone
+)
+
+// write writes the value of the field masked by the policy
+func (m *Masking) write(w userWriter, policy MaskPolicy, field maskField, value string) {
+	switch policy {
+	case MaskRedact:
+		w.WriteString(redacted)
+	case MaskHash:
+		mac := hmac.New(sha256.New, []byte(m.Salt))
+		mac.Write([]byte(value))
+		var sum [sha256.Size]byte
+		var buf [2 * sha256.Size]byte
+		hex.Encode(buf[:], mac.Sum(sum[:0]))
+		w.WriteString("hmac:")
+		w.Write(buf[:hashLen])
+	case MaskPartial:
+		switch field {
+		case fieldEmail:
+			writePartialEmail(w, value)
+		case fieldPhone:
+			writePartialPhone(w, value)
+		default:
+			writePartialName(w, value)
+		}
+	case MaskDefault:
+		if field == fieldEmail {
+			writeAt(w, value)
+			return
+		}
+		w.WriteString(value)
+	default:
+		w.WriteString(value)
+	}
+}
+
+// writeAt writes the email replacing "@" with " [at] "
+func writeAt(w userWriter, email string) {
+	for {
+		at := strings.IndexByte(email, '@')
+		if at < 0 {
+			break
+		}
+		w.WriteString(email[:at])
+		w.WriteString(" [at] ")
+		email = email[at+1:]
+	}
+	w.WriteString(email)
+}
+
+// writeFirstLetter writes the first letter of s and *** instead of the rest
+func writeFirstLetter(w userWriter, s string) {
+	if s == "" {
+		return
+	}
+	_, size := utf8.DecodeRuneInString(s)
+	w.WriteString(s[:size])
+	w.WriteString("***")
+}
+
+// writePartialEmail writes john@example.com as j***@example.com
+func writePartialEmail(w userWriter, email string) {
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		writeFirstLetter(w, email)
+		return
+	}
+	writeFirstLetter(w, email[:at])
+	w.WriteString(email[at:])
+}
+
+// writePartialName writes John Smith as J*** S***
+func writePartialName(w userWriter, name string) {
+	for i, word := range strings.Fields(name) {
+		if i > 0 {
+			w.WriteByte(' ')
+		}
+		writeFirstLetter(w, word)
+	}
+}
+
+// writePartialPhone keeps the last two digits: 176-88-49 is ***-**-49
+func writePartialPhone(w userWriter, phone string) {
+	digits := 0
+	for i := 0; i < len(phone); i++ {
+		if '0' <= phone[i] && phone[i] <= '9' {
+			digits++
+		}
+	}
+	for i := 0; i < len(phone); i++ {
+		c := phone[i]
+		if '0' <= c && c <= '9' {
+			digits--
+			if digits >= 2 {
+				c = '*'
+			}
+		}
+		w.WriteByte(c)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteUserMasking(t *testing.T) {
+	user := &User{Name: "John Smith", Email: "john@example.com", Phone: "176-88-49"}
+
+	cases := []struct {
+		mask     Masking
+		expected string
+	}{
+		{Masking{}, "[7] John Smith <john [at] example.com>\n"},
+		{Masking{Email: MaskKeep}, "[7] John Smith <john@example.com>\n"},
+		{Masking{Name: MaskPartial, Email: MaskPartial}, "[7] J*** S*** <j***@example.com>\n"},
+		{Masking{Name: MaskRedact, Email: MaskRedact}, "[7] [redacted] <[redacted]>\n"},
+		{Masking{ShowPhone: true}, "[7] John Smith <john [at] example.com> 176-88-49\n"},
+		{Masking{Phone: MaskPartial, ShowPhone: true}, "[7] John Smith <john [at] example.com> ***-**-49\n"},
+		{Masking{Phone: MaskRedact, ShowPhone: true}, "[7] John Smith <john [at] example.com> [redacted]\n"},
+	}
+
+	for _, c := range cases {
+		out := &bytes.Buffer{}
+		writeUser(out, 7, user, &c.mask)
+		if out.String() != c.expected {
+			t.Errorf("%+v: got %q, expected %q", c.mask, out.String(), c.expected)
+		}
+	}
+}
+
+func TestMaskHash(t *testing.T) {
+	hash := func(mask Masking, email string) string {
+		out := &bytes.Buffer{}
+		mask.Email = MaskHash
+		writeUser(out, 0, &User{Name: "John", Email: email}, &mask)
+		return out.String()
+	}
+
+	first := hash(Masking{Salt: "salt"}, "john@example.com")
+	if !strings.HasPrefix(first, "[0] John <hmac:") || len(first) != len("[0] John <hmac:>\n")+hashLen {
+		t.Errorf("unexpected hash output %q", first)
+	}
+	if strings.Contains(first, "john") {
+		t.Errorf("email is not hidden: %q", first)
+	}
+	if hash(Masking{Salt: "salt"}, "john@example.com") != first {
+		t.Error("the same email gave different hashes")
+	}
+	if hash(Masking{Salt: "salt"}, "bob@example.com") == first {
+		t.Error("different emails gave the same hash")
+	}
+	if hash(Masking{Salt: "pepper"}, "john@example.com") == first {
+		t.Error("salt does not change the hash")
+	}
+
+	if err := (&Masking{Phone: MaskHash}).Validate(); err != ErrNoMaskSalt {
+		t.Errorf("expected ErrNoMaskSalt, got %v", err)
+	}
+	s := Searcher{Mask: Masking{Email: MaskHash}}
+	if err := s.SearchReader(strings.NewReader(""), &bytes.Buffer{}); err != ErrNoMaskSalt {
+		t.Errorf("search without a salt: expected ErrNoMaskSalt, got %v", err)
+	}
+}
+
+func TestParseMaskPolicy(t *testing.T) {
+	for _, name := range maskPolicyNames {
+		policy, err := ParseMaskPolicy(name)
+		if err != nil || policy.String() != name {
+			t.Errorf("%s: got %v, %v", name, policy, err)
+		}
+	}
+	if _, err := ParseMaskPolicy("hide"); err == nil {
+		t.Error("expected an error for unknown policy")
+	}
+}
+
+func TestSearchMasked(t *testing.T) {
+	s := Searcher{
+		Query: DefaultQuery(),
+		Mask:  Masking{Name: MaskRedact, Email: MaskPartial, Phone: MaskPartial, ShowPhone: true},
+	}
+	result := searchString(t, s)
+	expected := searchString(t, Searcher{Query: DefaultQuery()})
+
+	if strings.Contains(result, " [at] ") {
+		t.Errorf("emails are not masked:\n%s", result)
+	}
+	if users := strings.Count(expected, "\n["); users == 0 || strings.Count(result, redacted) != users {
+		t.Errorf("not all names are redacted:\n%s", result)
+	}
+	if !strings.HasSuffix(result, expected[strings.Index(expected, "\nTotal"):]) {
+		t.Errorf("unexpected total:\n%s", result)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+)
+
+// defaultChunkSize is the size of chunks read by the parallel search
+const defaultChunkSize = 256 * 1024
+
+// chunk is a part of the file cut at a line boundary
+type chunk struct {
+	seq int
+	// firstLine is the index of the first line of the chunk in the file
+	firstLine int
+	data      []byte
+}
+
+type chunkResult struct {
+	seq       int
+	out       *bytes.Buffer
+	malformed []malformedLine
+	err       error
+}
+
+// searchParallel splits the file into chunks of whole lines and matches them on s.Workers
+// goroutines. Found users are written into w in the file order, so the output is the
+// same as the serial one.
+func (s *Searcher) searchParallel(r io.Reader, w userWriter) (searchResult, error) {
+	chunkSize := s.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	chunks := make(chan chunk, s.Workers)
+	results := make(chan chunkResult, s.Workers)
+	readErr := make(chan error, 1)
+	dataPool := sync.Pool{New: func() interface{} { return make([]byte, 0, chunkSize) }}
+	outPool := sync.Pool{New: func() interface{} { return &bytes.Buffer{} }}
+
+	go func() {
+		defer close(chunks)
+		readErr <- readChunks(r, chunkSize, &dataPool, chunks, done)
+	}()
+
+	matchers := make([]*userMatcher, s.Workers)
+	wg := &sync.WaitGroup{}
+	for i := range matchers {
+		matcher := newUserMatcher(&s.Query, &s.Mask)
+		matchers[i] = matcher
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range chunks {
+				out := outPool.Get().(*bytes.Buffer)
+				out.Reset()
+				err := matcher.matchChunk(c, s.Lenient, out)
+				dataPool.Put(c.data[:0])
+				result := chunkResult{seq: c.seq, out: out, malformed: matcher.malformed, err: err}
+				matcher.malformed = nil
+
+				select {
+				case results <- result:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// chunks come in any order, keep them until the previous ones are written
+	pending := make(map[int]chunkResult)
+	next := 0
+	var malformed []malformedLine
+	for result := range results {
+		pending[result.seq] = result
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			if result.err != nil {
+				return searchResult{}, result.err
+			}
+			w.Write(result.out.Bytes())
+			malformed = append(malformed, result.malformed...)
+			outPool.Put(result.out)
+			delete(pending, next)
+			next++
+		}
+	}
+	if err := <-readErr; err != nil {
+		return searchResult{}, err
+	}
+
+	seenBrowsers := matchers[0].seenBrowsers
+	for _, matcher := range matchers[1:] {
+		for browser := range matcher.seenBrowsers {
+			seenBrowsers[browser] = struct{}{}
+		}
+	}
+	return searchResult{browsers: len(seenBrowsers), malformed: malformed}, nil
+}
+
+// readChunks reads r into chunks ending with '\n', except the last one.
+// A line longer than maxLineSize is an error as in the serial search.
+func readChunks(r io.Reader, chunkSize int, pool *sync.Pool, chunks chan<- chunk, done <-chan struct{}) error {
+	var tail []byte
+	seq, line := 0, 0
+
+	for {
+		data := append(pool.Get().([]byte)[:0], tail...)
+		// make room for a whole chunk after the tail of the previous one
+		if cap(data)-len(data) < chunkSize {
+			grown := make([]byte, len(data), len(data)+chunkSize)
+			copy(grown, data)
+			data = grown
+		}
+		n, err := io.ReadFull(r, data[len(data):len(data)+chunkSize])
+		data = data[:len(data)+n]
+		eof := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return err
+		}
+
+		cut := len(data)
+		if !eof {
+			cut = bytes.LastIndexByte(data, '\n') + 1
+		}
+		// keep the unfinished line for the next chunk
+		tail = append(tail[:0], data[cut:]...)
+		data = data[:cut]
+		if len(tail) > maxLineSize {
+			return bufio.ErrTooLong
+		}
+
+		if len(data) > 0 {
+			select {
+			case chunks <- chunk{seq: seq, firstLine: line, data: data}:
+			case <-done:
+				return nil
+			}
+			seq++
+			line += bytes.Count(data, []byte{'\n'})
+		}
+		if eof {
+			return nil
+		}
+	}
+}
+
+// matchChunk writes users of the chunk matching the query into out.
+// Lines are split like bufio.ScanLines does.
+func (m *userMatcher) matchChunk(c chunk, lenient bool, out userWriter) error {
+	data := c.data
+	for i := c.firstLine; len(data) > 0; i++ {
+		line := data
+		if end := bytes.IndexByte(data, '\n'); end >= 0 {
+			line, data = data[:end], data[end+1:]
+		} else {
+			data = nil
+		}
+		line = bytes.TrimSuffix(line, []byte{'\r'})
+
+		if err := m.matchLine(i, line, lenient, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// scaledUsersFile writes the users file repeated n times into a temporary file
+func scaledUsersFile(tb testing.TB, n int) string {
+	data, err := ioutil.ReadFile(filePathFast)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	data = bytes.TrimSuffix(data, []byte{'\n'})
+
+	buf := &bytes.Buffer{}
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.Write(data)
+	}
+
+	path := filepath.Join(tb.TempDir(), "users.txt")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+func searchString(t *testing.T, s Searcher) string {
+	out := &bytes.Buffer{}
+	if err := s.Search(out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return out.String()
+}
+
+func TestParallelSearch(t *testing.T) {
+	paths := []string{filePathFast, scaledUsersFile(t, 10)}
+	queries := []Query{
+		DefaultQuery(),
+		{Require: []string{"Chrome"}, Forbid: []string{"Windows"}},
+	}
+
+	for _, path := range paths {
+		for _, q := range queries {
+			expected := searchString(t, Searcher{Query: q, Path: path})
+
+			for _, workers := range []int{2, 3, 8} {
+				// small chunks cut lines in the middle many times
+				for _, chunkSize := range []int{0, 1000, 4096} {
+					s := Searcher{Query: q, Path: path, Workers: workers, ChunkSize: chunkSize}
+					if result := searchString(t, s); result != expected {
+						t.Fatalf("%s, %d workers, chunk %d: results not match\nGot:\n%v\nExpected:\n%v",
+							path, workers, chunkSize, result, expected)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestParallelSearchErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	data := []byte("{\"browsers\":[\"MSIE\"]}\n{\"browsers\":\n{}")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := Searcher{Query: DefaultQuery(), Path: path, Workers: 4, ChunkSize: 4}
+	if err := s.Search(ioutil.Discard); err == nil {
+		t.Error("expected an error for the broken line")
+	}
+
+	s.Path = filepath.Join(t.TempDir(), "missing.txt")
+	if err := s.Search(ioutil.Discard); err == nil {
+		t.Error("expected an error for the missing file")
+	}
+}
+
+// -----
+// go test -bench Scaled -benchmem
+
+func benchmarkScaled(b *testing.B, workers int) {
+	path := scaledUsersFile(b, 100)
+	s := Searcher{Query: DefaultQuery(), Path: path, Workers: workers}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := s.Search(ioutil.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScaledSerial(b *testing.B) {
+	benchmarkScaled(b, 1)
+}
+
+func BenchmarkScaledParallel(b *testing.B) {
+	benchmarkScaled(b, runtime.GOMAXPROCS(0))
+}
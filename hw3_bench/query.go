@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	errNoEmail    = errors.New("missing email")
+	errNoBrowsers = errors.New("browsers is not a list")
+)
+
+// Query describes users we are looking for
+type Query struct {
+	// Require lists substrings each of which must be found in some of the user browsers
+	Require []string
+	// Forbid lists substrings none of the user browsers may contain
+	Forbid []string
+	// Country, Company and Job filter users by the exact value if they are set
+	Country string
+	Company string
+	Job     string
+}
+
+// DefaultQuery looks for users having both Android and MSIE browsers
+func DefaultQuery() Query {
+	return Query{Require: []string{"Android", "MSIE"}}
+}
+
+// userMatcher decodes lines and matches users against the query.
+// It reuses its memory between lines, so it is not safe for concurrent use.
+type userMatcher struct {
+	query *Query
+	// mask is used to write found users, it is nil if they are not written
+	mask  *Masking
+	user  User
+	lexer jsonLexer
+	// found marks Require substrings found in the current user browsers
+	found []bool
+	// seenBrowsers are browsers containing any of Require substrings
+	// of users passed Country, Company and Job filters
+	seenBrowsers map[string]struct{}
+	// malformed are lines skipped in the lenient mode
+	malformed []malformedLine
+}
+
+func newUserMatcher(q *Query, mask *Masking) *userMatcher {
+	return &userMatcher{
+		query:        q,
+		mask:         mask,
+		lexer:        jsonLexer{},
+		found:        make([]bool, len(q.Require)),
+		seenBrowsers: make(map[string]struct{}),
+	}
+}
+
+// view decodes the line into m.user and calls fn with it or with the decoding error.
+// Strings of the user point into the line to avoid copying, so they are valid
+// only until fn returns and fn must copy what it keeps. The user is cleared after fn.
+func (m *userMatcher) view(line []byte, fn func(user *User, err error) error) error {
+	m.user.reset()
+	m.lexer.reset(line)
+	m.lexer.aliasStrings = true
+	m.user.decodeFastJSON(&m.lexer)
+	m.lexer.end()
+	m.lexer.aliasStrings = false
+
+	err := fn(&m.user, m.lexer.err)
+	m.user.reset()
+	m.lexer.reset(nil)
+	return err
+}
+
+// matchLine writes the user of the i-th line into w if it matches the query.
+// In the lenient mode a malformed line is remembered instead of returning an error.
+// A user without browsers is skipped as SlowSearch does, in the lenient mode it is malformed.
+func (m *userMatcher) matchLine(i int, line []byte, lenient bool, w userWriter) error {
+	err := m.view(line, func(user *User, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case !user.hasBrowsers:
+			if !lenient {
+				return nil
+			}
+			return errNoBrowsers
+		case m.match():
+			if !user.hasEmail {
+				return errNoEmail
+			}
+			writeUser(w, i, user, m.mask)
+		}
+		return nil
+	})
+	if err == nil {
+		return nil
+	}
+
+	if !lenient {
+		return fmt.Errorf("line %d: %w", i+1, err)
+	}
+	m.malformed = append(m.malformed, malformedLine{line: i + 1, reason: err.Error()})
+	return nil
+}
+
+// match reports whether the decoded user matches the query
+// and remembers browsers of the user
+func (m *userMatcher) match() bool {
+	q, user := m.query, &m.user
+
+	if (q.Country != "" && user.Country != q.Country) ||
+		(q.Company != "" && user.Company != q.Company) ||
+		(q.Job != "" && user.Job != q.Job) {
+		return false
+	}
+
+	for i := range m.found {
+		m.found[i] = false
+	}
+	forbidden := false
+
+	for _, browser := range user.Browsers {
+		browserFound := len(q.Require) == 0
+		for i, substr := range q.Require {
+			if strings.Contains(browser, substr) {
+				m.found[i] = true
+				browserFound = true
+			}
+		}
+		for _, substr := range q.Forbid {
+			if strings.Contains(browser, substr) {
+				forbidden = true
+			}
+		}
+
+		if browserFound {
+			m.seeBrowser(browser)
+		}
+	}
+
+	if forbidden {
+		return false
+	}
+	for _, found := range m.found {
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *userMatcher) seeBrowser(browser string) {
+	// the browser points into the line, so we keep a copy
+	if _, seen := m.seenBrowsers[browser]; !seen {
+		m.seenBrowsers[strings.Clone(browser)] = struct{}{}
+	}
+}
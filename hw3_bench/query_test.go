@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// naiveSearch is a straightforward implementation of Searcher used as a reference
+func naiveSearch(t *testing.T, q Query) string {
+	data, err := ioutil.ReadFile(filePathFast)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	found := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		user := User{}
+		if err := json.Unmarshal([]byte(line), &user); err != nil {
+			t.Fatal(err)
+		}
+		if (q.Country != "" && q.Country != user.Country) ||
+			(q.Company != "" && q.Company != user.Company) ||
+			(q.Job != "" && q.Job != user.Job) {
+			continue
+		}
+
+		ok := true
+		for _, substr := range q.Require {
+			has := false
+			for _, browser := range user.Browsers {
+				if strings.Contains(browser, substr) {
+					has = true
+					seen[browser] = true
+				}
+			}
+			ok = ok && has
+		}
+		for _, browser := range user.Browsers {
+			if len(q.Require) == 0 {
+				seen[browser] = true
+			}
+			for _, substr := range q.Forbid {
+				if strings.Contains(browser, substr) {
+					ok = false
+				}
+			}
+		}
+		if ok {
+			found += fmt.Sprintf("[%d] %s <%s>\n", i, user.Name, strings.Replace(user.Email, "@", " [at] ", -1))
+		}
+	}
+	return fmt.Sprintf("found users:\n%s\nTotal unique browsers %d\n", found, len(seen))
+}
+
+func TestSearcherQueries(t *testing.T) {
+	queries := []Query{
+		DefaultQuery(),
+		{Require: []string{"Android"}, Forbid: []string{"MSIE", "Firefox"}},
+		{Require: []string{"Chrome", "Safari", "Opera"}},
+		{Forbid: []string{"Windows"}, Country: "Russia"},
+		{Require: []string{"MSIE"}, Company: "Flashpoint"},
+		{Require: []string{"Android"}, Job: "Programmer Analyst #{N}"},
+	}
+
+	for i, q := range queries {
+		s := Searcher{Query: q}
+		out := &bytes.Buffer{}
+		if err := s.Search(out); err != nil {
+			t.Fatalf("[%d] unexpected error: %v", i, err)
+		}
+		if expected := naiveSearch(t, q); out.String() != expected {
+			t.Errorf("[%d] results not match\nGot:\n%v\nExpected:\n%v", i, out.String(), expected)
+		}
+	}
+}
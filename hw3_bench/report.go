@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Count is a number of browsers with the name
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Report counts browsers of all users by family, OS and device class.
+// Every browser of every user is counted, so the same user-agent may be counted many times.
+type Report struct {
+	Users          int `json:"users"`
+	Browsers       int `json:"browsers"`
+	UniqueBrowsers int `json:"unique_browsers"`
+	// Malformed is the number of lines skipped in the lenient mode
+	Malformed int     `json:"malformed,omitempty"`
+	Families  []Count `json:"families"`
+	OS        []Count `json:"os"`
+	Devices   []Count `json:"devices"`
+}
+
+// Report reads the users file and returns the report with top entries of every table,
+// all of them if top is not positive. The query is not used, all users are counted.
+// In the lenient mode malformed lines are skipped and counted.
+func (s *Searcher) Report(top int) (*Report, error) {
+	file, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return s.ReportReader(file, top)
+}
+
+// ReportReader works like Report reading users from r instead of the file
+func (s *Searcher) ReportReader(r io.Reader, top int) (*Report, error) {
+	// user-agents repeat a lot, so each of them is parsed once
+	agents := make(map[string]UserAgent)
+	families := make(map[string]int)
+	oses := make(map[string]int)
+	devices := make(map[string]int)
+
+	report := &Report{}
+	matcher := newUserMatcher(&s.Query, nil)
+	err := scanLines(r, func(i int, line []byte) error {
+		return matcher.view(line, func(user *User, err error) error {
+			if err != nil {
+				if s.Lenient {
+					report.Malformed++
+					return nil
+				}
+				return fmt.Errorf("line %d: %w", i+1, err)
+			}
+			report.Users++
+			for _, browser := range user.Browsers {
+				agent, ok := agents[browser]
+				if !ok {
+					agent = ParseUserAgent(browser)
+					// the browser points into the line, so the map keeps a copy
+					agents[strings.Clone(browser)] = agent
+				}
+				families[agent.Family]++
+				oses[agent.OS]++
+				devices[agent.Device]++
+				report.Browsers++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.UniqueBrowsers = len(agents)
+	report.Families = topCounts(families, top)
+	report.OS = topCounts(oses, top)
+	report.Devices = topCounts(devices, top)
+	return report, nil
+}
+
+// topCounts sorts counts by the number descending and then by the name
+func topCounts(counts map[string]int, top int) []Count {
+	result := make([]Count, 0, len(counts))
+	for name, count := range counts {
+		result = append(result, Count{Name: name, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	if top > 0 && len(result) > top {
+		result = result[:top]
+	}
+	return result
+}
+
+type reportTable struct {
+	name   string
+	title  string
+	counts []Count
+}
+
+func (r *Report) tables() []reportTable {
+	return []reportTable{
+		{"family", "Browser", r.Families},
+		{"os", "OS", r.OS},
+		{"device", "Device", r.Devices},
+	}
+}
+
+// WriteText writes the report as aligned tables with shares of all browsers
+func (r *Report) WriteText(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Users %d, browsers %d, unique %d\n", r.Users, r.Browsers, r.UniqueBrowsers)
+	for _, table := range r.tables() {
+		fmt.Fprintf(w, "\n%s\tcount\tshare\n", table.title)
+		for _, c := range table.counts {
+			share := 0.0
+			if r.Browsers > 0 {
+				share = 100 * float64(c.Count) / float64(r.Browsers)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%.1f%%\n", c.Name, c.Count, share)
+		}
+	}
+	return w.Flush()
+}
+
+// WriteJSON writes the report as a JSON object
+func (r *Report) WriteJSON(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes rows "table,name,count", totals go into the "total" table
+func (r *Report) WriteCSV(out io.Writer) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"table", "name", "count"})
+	w.Write([]string{"total", "users", strconv.Itoa(r.Users)})
+	w.Write([]string{"total", "browsers", strconv.Itoa(r.Browsers)})
+	w.Write([]string{"total", "unique_browsers", strconv.Itoa(r.UniqueBrowsers)})
+	for _, table := range r.tables() {
+		for _, c := range table.counts {
+			w.Write([]string{table.name, c.Name, strconv.Itoa(c.Count)})
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// Write writes the report in the format: text, json or csv
+func (r *Report) Write(out io.Writer, format string) error {
+	switch format {
+	case "", "text":
+		return r.WriteText(out)
+	case "json":
+		return r.WriteJSON(out)
+	case "csv":
+		return r.WriteCSV(out)
+	}
+	return fmt.Errorf("unknown report format %q", format)
+}
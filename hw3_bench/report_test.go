@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	cases := []struct {
+		ua       string
+		expected UserAgent
+	}{
+		{
+			"Mozilla/5.0 (Linux; Android 4.4.4; XT1032 Build/KXB21.14-L1.61) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/45.0.2454.94 Mobile Safari/537.36",
+			UserAgent{"Chrome", "Android", DeviceMobile},
+		},
+		{
+			"Mozilla/5.0 (MSIE 9.0; Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/51.0.2704.79 Safari/537.36 Edge/14.14931",
+			UserAgent{"Edge", "Windows", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (Windows; U; Windows NT 5.1; en-US; rv:1.9.0.10) Gecko/2009042316 Firefox/3.0.10",
+			UserAgent{"Firefox", "Windows", DeviceDesktop},
+		},
+		{
+			"Mozilla/4.0 (compatible; MSIE 6.0; Windows NT 5.1; SV1)",
+			UserAgent{"IE", "Windows", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (X11; Linux i686) AppleWebKit/537.36 (KHTML, like Gecko) Ubuntu Chromium/51.0.2704.79 Chrome/51.0.2704.79 Safari/537.36",
+			UserAgent{"Chromium", "Linux", DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (iPad; CPU OS 6_0 like Mac OS X) AppleWebKit/536.26 (KHTML, like Gecko) Version/6.0 Mobile/10A5355d Safari/8536.25",
+			UserAgent{"Safari", "iOS", DeviceTablet},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 4.0.4; BNTV400 Build/IMM76L) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/42.0.2311.111 Safari/537.36",
+			UserAgent{"Chrome", "Android", DeviceTablet},
+		},
+		{
+			"Opera/9.80 (J2ME/MIDP; Opera Mini/5.0.16823/1428; U; en) Presto/2.2.0",
+			UserAgent{"Opera", "J2ME", DeviceMobile},
+		},
+		{
+			"msnbot/1.1 ( http://search.msn.com/msnbot.htm)",
+			UserAgent{"Bot", unknown, DeviceBot},
+		},
+		{
+			"Roku/DVP-4.1 (024.01E01250A)",
+			UserAgent{unknown, unknown, DeviceOther},
+		},
+	}
+
+	for _, c := range cases {
+		if agent := ParseUserAgent(c.ua); agent != c.expected {
+			t.Errorf("%s\ngot %+v, expected %+v", c.ua, agent, c.expected)
+		}
+	}
+}
+
+func sumCounts(counts []Count) int {
+	sum := 0
+	for _, c := range counts {
+		sum += c.Count
+	}
+	return sum
+}
+
+func TestReport(t *testing.T) {
+	s := Searcher{}
+	report, err := s.Report(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if report.Users != 1000 || report.Browsers != 4000 || report.UniqueBrowsers != 670 {
+		t.Errorf("bad totals: %+v", report)
+	}
+	for _, table := range report.tables() {
+		if sum := sumCounts(table.counts); sum != report.Browsers {
+			t.Errorf("%s: %d browsers counted, expected %d", table.name, sum, report.Browsers)
+		}
+		for i := 1; i < len(table.counts); i++ {
+			if table.counts[i-1].Count < table.counts[i].Count {
+				t.Errorf("%s is not sorted: %v", table.name, table.counts)
+				break
+			}
+		}
+	}
+
+	top, err := s.Report(3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(top.Families) != 3 || !reflect.DeepEqual(top.Families, report.Families[:3]) {
+		t.Errorf("bad top families: %v", top.Families)
+	}
+}
+
+func TestReportFormats(t *testing.T) {
+	report := &Report{
+		Users:          2,
+		Browsers:       3,
+		UniqueBrowsers: 2,
+		Families:       []Count{{"Chrome", 2}, {"IE", 1}},
+		OS:             []Count{{"Windows", 3}},
+		Devices:        []Count{{DeviceDesktop, 3}},
+	}
+
+	out := &bytes.Buffer{}
+	if err := report.Write(out, "json"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	decoded := &Report{}
+	if err := json.Unmarshal(out.Bytes(), decoded); err != nil {
+		t.Fatalf("bad json: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, report) {
+		t.Errorf("got %+v, expected %+v", decoded, report)
+	}
+
+	out.Reset()
+	if err := report.Write(out, "csv"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	records, err := csv.NewReader(out).ReadAll()
+	if err != nil {
+		t.Fatalf("bad csv: %v", err)
+	}
+	expected := [][]string{
+		{"table", "name", "count"},
+		{"total", "users", "2"},
+		{"total", "browsers", "3"},
+		{"total", "unique_browsers", "2"},
+		{"family", "Chrome", "2"},
+		{"family", "IE", "1"},
+		{"os", "Windows", "3"},
+		{"device", "desktop", "3"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("got %v, expected %v", records, expected)
+	}
+
+	out.Reset()
+	if err := report.Write(out, "text"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Contains(out.Bytes(), []byte("Chrome   2      66.7%")) {
+		t.Errorf("unexpected text report:\n%s", out.String())
+	}
+
+	if err := report.Write(out, "xml"); err == nil {
+		t.Error("expected an error for unknown format")
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+//go:generate go run ./jsongen -type User -output user_json.go user.go
+
+// User is a line of the users file
+type User struct {
+	Browsers []string `json:"browsers,present"`
+	Company  string   `json:"company"`
+	Country  string   `json:"country"`
+	Email    string   `json:"email,present"`
+	Job      string   `json:"job"`
+	Name     string   `json:"name"`
+	Phone    string   `json:"phone"`
+
+	// hasBrowsers and hasEmail tell the keys were in the line and not null,
+	// an empty email is still an email. They are set by the present option of
+	// the generated decoder only, encoding/json leaves them false.
+	hasBrowsers bool
+	hasEmail    bool
+}
+
+// reset clears the user keeping memory of Browsers for the next line.
+// The old browsers are cleared too, they may point into the previous line.
+func (u *User) reset() {
+	clear(u.Browsers[:cap(u.Browsers)])
+	*u = User{Browsers: u.Browsers[:0]}
+}
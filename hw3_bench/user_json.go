@@ -0,0 +1,77 @@
+// Code generated by jsongen from user.go; DO NOT EDIT.
+
+package main
+
+// userFastJSONKeys are JSON names of User fields
+var userFastJSONKeys = []string{
+	"browsers",
+	"company",
+	"country",
+	"email",
+	"job",
+	"name",
+	"phone",
+}
+
+// UnmarshalFastJSON decodes a JSON object into User without reflection
+func (v *User) UnmarshalFastJSON(data []byte) error {
+	l := jsonLexer{data: data}
+	v.decodeFastJSON(&l)
+	l.end()
+	return l.err
+}
+
+func (v *User) decodeFastJSON(l *jsonLexer) {
+	if l.null() {
+		return
+	}
+	l.delim('{')
+	for first := true; l.more('}', first); first = false {
+		switch l.field(userFastJSONKeys) {
+		case "browsers":
+			if l.null() {
+				v.Browsers = nil
+				continue
+			}
+			v.hasBrowsers = true
+			if v.Browsers == nil {
+				v.Browsers = []string{}
+			} else {
+				v.Browsers = v.Browsers[:0]
+			}
+			l.delim('[')
+			for first := true; l.more(']', first); first = false {
+				v.Browsers = append(v.Browsers, l.string())
+			}
+			l.delim(']')
+		case "company":
+			if !l.null() {
+				v.Company = l.string()
+			}
+		case "country":
+			if !l.null() {
+				v.Country = l.string()
+			}
+		case "email":
+			if !l.null() {
+				v.Email = l.string()
+				v.hasEmail = true
+			}
+		case "job":
+			if !l.null() {
+				v.Job = l.string()
+			}
+		case "name":
+			if !l.null() {
+				v.Name = l.string()
+			}
+		case "phone":
+			if !l.null() {
+				v.Phone = l.string()
+			}
+		default:
+			l.skip()
+		}
+	}
+	l.delim('}')
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readUserLines(tb testing.TB) [][]byte {
+	data, err := ioutil.ReadFile(filePathFast)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return bytes.Split(data, []byte("\n"))
+}
+
+func TestUserFastJSONMatchesStdlib(t *testing.T) {
+	lines := readUserLines(t)
+	lines = append(lines,
+		[]byte(`{"name":"Jo\"hn \\ \/ Ж😀\n","email":null,"browsers":[]}`),
+		[]byte(` { "extra" : {"a":[1,2.5e-3,true,false,null,{"b":"c"}]}, "browsers" : null , "job":"x" } `),
+		[]byte(`{"browsers":["a","b"],"phone":"1"}`),
+		[]byte(`{"email":"","browsers":null}`),
+		[]byte(`{"Email":"a@b","NAME":"x","browsers":["a"],"Browsers":["b"],"\u004Aob":"j"}`),
+		[]byte(`null`),
+	)
+
+	for i, line := range lines {
+		expected := User{}
+		if err := json.Unmarshal(line, &expected); err != nil {
+			t.Fatalf("[%d] stdlib error: %v", i, err)
+		}
+		// the stdlib does not know about presence flags, keys with values other than null set them
+		keys := map[string]interface{}{}
+		json.Unmarshal(line, &keys)
+		for key, value := range keys {
+			expected.hasBrowsers = expected.hasBrowsers || strings.EqualFold(key, "browsers") && value != nil
+			expected.hasEmail = expected.hasEmail || strings.EqualFold(key, "email") && value != nil
+		}
+
+		got := User{}
+		if err := got.UnmarshalFastJSON(line); err != nil {
+			t.Fatalf("[%d] unexpected error: %v", i, err)
+		}
+		if !reflect.DeepEqual(expected, got) {
+			t.Errorf("[%d] results not match\nGot: %#v\nExpected: %#v", i, got, expected)
+		}
+	}
+}
+
+func TestUserFastJSONErrors(t *testing.T) {
+	cases := []string{
+		``,
+		`{`,
+		`{"name":}`,
+		`{"name":"a",}`,
+		`{"name":"a" "job":"b"}`,
+		`{"name":1}`,
+		`{"browsers":["a",]}`,
+		`{"browsers":"a"}`,
+		`{"name":"\x"}`,
+		`{"name":"\u12"}`,
+		`{"extra":tru}`,
+		`{"extra":-}`,
+		`{} {}`,
+		"{\"name\":\"a\tb\"}",
+	}
+	for _, c := range cases {
+		u := User{}
+		if err := u.UnmarshalFastJSON([]byte(c)); err == nil {
+			t.Errorf("expected error for %q", c)
+		}
+		if err := json.Unmarshal([]byte(c), &u); err == nil {
+			t.Errorf("stdlib accepts %q", c)
+		}
+	}
+}
+
+// -----
+// go test -bench Decode -benchmem
+
+func BenchmarkDecodeStdlib(b *testing.B) {
+	lines := readUserLines(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			u := User{}
+			if err := json.Unmarshal(line, &u); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkDecodeFastJSON(b *testing.B) {
+	lines := readUserLines(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			u := User{}
+			if err := u.UnmarshalFastJSON(line); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkDecodeFastJSONReuse decodes like FastSearch does:
+// the same user and strings pointing into the line
+func BenchmarkDecodeFastJSONReuse(b *testing.B) {
+	data, err := ioutil.ReadFile(filePathFast)
+	if err != nil {
+		b.Fatal(err)
+	}
+	u := &User{}
+	l := &jsonLexer{aliasStrings: true}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			u.reset()
+			l.reset(scanner.Bytes())
+			u.decodeFastJSON(l)
+			if l.end(); l.err != nil {
+				b.Fatal(l.err)
+			}
+		}
+	}
+}
+
+func TestUserFastJSONCopiesStrings(t *testing.T) {
+	line := []byte(`{"name":"Ann","browsers":["Android 4"]}`)
+	u := User{}
+	if err := u.UnmarshalFastJSON(line); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the line is reused by scanners and chunk pools
+	for i := range line {
+		line[i] = ' '
+	}
+	if u.Name != "Ann" || len(u.Browsers) != 1 || u.Browsers[0] != "Android 4" {
+		t.Errorf("decoded strings point into the line: %#v", u)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+)
+
+// UserAgent is a browser family, an operating system and a device class
+// recognized in a user-agent string
+type UserAgent struct {
+	Family string
+	OS     string
+	Device string
+}
+
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceOther   = "other"
+
+	unknown = "Other"
+)
+
+// uaRule maps any of the substrings to the name
+type uaRule struct {
+	name   string
+	tokens []string
+}
+
+// rules are checked in order, the first matched wins,
+// so browsers based on others go before them:
+// Edge says it is Chrome, Chrome says it is Safari and so on
+var familyRules = []uaRule{
+	{"Bot", []string{"bot", "Bot", "crawler", "spider", "Slurp", "facebookexternalhit", "Validator"}},
+	{"Tool", []string{"Wget/", "curl/", "libwww", "Python-urllib", "Java/"}},
+	{"UC Browser", []string{"UCWEB", "UCBrowser"}},
+	{"Edge", []string{"Edge/", "Edg/"}},
+	{"Opera", []string{"OPR/", "Opera"}},
+	{"Maxthon", []string{"Maxthon"}},
+	{"SeaMonkey", []string{"SeaMonkey"}},
+	{"Camino", []string{"Camino"}},
+	{"Epiphany", []string{"Epiphany"}},
+	{"Konqueror", []string{"Konqueror"}},
+	{"Chromium", []string{"Chromium"}},
+	{"Chrome", []string{"Chrome/", "CriOS/"}},
+	{"Firefox", []string{"Firefox/"}},
+	{"IE", []string{"MSIE", "Trident/"}},
+	{"Netscape", []string{"Netscape", "Navigator/"}},
+	{"Safari", []string{"Safari/"}},
+	{"Lynx", []string{"Lynx/"}},
+	{"NetFront", []string{"NetFront"}},
+	{"Openwave", []string{"UP.Browser"}},
+}
+
+var osRules = []uaRule{
+	{"Windows Mobile", []string{"Windows Phone", "Windows Mobile", "Windows CE", "WindowsCE"}},
+	{"Windows", []string{"Windows", "Win98", "Win95", "Win 9x", "WinNT"}},
+	{"Android", []string{"Android"}},
+	{"iOS", []string{"iPhone", "iPad", "iPod"}},
+	{"macOS", []string{"Mac OS X", "Macintosh", "Mac_PowerPC"}},
+	{"BlackBerry", []string{"BlackBerry", "BB10"}},
+	{"Symbian", []string{"Symbian", "SymbOS", "Series60", "Series 60"}},
+	{"Linux", []string{"Linux", "X11", "Ubuntu"}},
+	{"BSD", []string{"FreeBSD", "OpenBSD", "NetBSD"}},
+	{"OS/2", []string{"OS/2"}},
+	{"J2ME", []string{"J2ME", "MIDP"}},
+}
+
+func (r uaRule) match(ua string) bool {
+	for _, token := range r.tokens {
+		if strings.Contains(ua, token) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRules(rules []uaRule, ua string) string {
+	for _, r := range rules {
+		if r.match(ua) {
+			return r.name
+		}
+	}
+	return unknown
+}
+
+var (
+	tabletTokens = uaRule{tokens: []string{"iPad", "Tablet", "Kindle", "Silk/"}}
+	mobileTokens = uaRule{tokens: []string{"Mobile", "Mobi", "iPhone", "iPod", "Phone",
+		"MIDP", "Symbian", "BlackBerry", "Opera Mini", "NetFront", "UP.Browser"}}
+)
+
+// ParseUserAgent recognizes the browser family, OS and device class by known substrings.
+// Unknown values are "Other".
+func ParseUserAgent(ua string) UserAgent {
+	agent := UserAgent{
+		Family: matchRules(familyRules, ua),
+		OS:     matchRules(osRules, ua),
+	}
+
+	switch {
+	case agent.Family == "Bot" || agent.Family == "Tool":
+		agent.Device = DeviceBot
+	case tabletTokens.match(ua):
+		agent.Device = DeviceTablet
+	case mobileTokens.match(ua):
+		agent.Device = DeviceMobile
+	case agent.OS == "Android":
+		// Android browsers without Mobile are tablets
+		agent.Device = DeviceTablet
+	case agent.OS == unknown && agent.Family == unknown:
+		agent.Device = DeviceOther
+	default:
+		agent.Device = DeviceDesktop
+	}
+	return agent
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Authenticator adds credentials to every request of SearchClient,
+// retries are authenticated again
+type Authenticator interface {
+	Authenticate(r *http.Request) error
+}
+
+// headers of HMAC signed requests
+const (
+	AuthKeyHeader       = "X-Auth-Key"
+	AuthTimestampHeader = "X-Auth-Timestamp"
+	AuthNonceHeader     = "X-Auth-Nonce"
+	AuthSignatureHeader = "X-Auth-Signature"
+)
+
+// HeaderAuth sends the token in the AccessToken header as SearchClient does by default
+type HeaderAuth struct {
+	Token string
+}
+
+func (a HeaderAuth) Authenticate(r *http.Request) error {
+	r.Header.Set("AccessToken", a.Token)
+	return nil
+}
+
+func (a HeaderAuth) identity() string {
+	return a.Token
+}
+
+// BearerAuth sends the token in the standard "Authorization: Bearer" header
+type BearerAuth struct {
+	Token string
+}
+
+func (a BearerAuth) Authenticate(r *http.Request) error {
+	r.Header.Set("Authorization", "Bearer "+a.Token)
+	return nil
+}
+
+func (a BearerAuth) identity() string {
+	return a.Token
+}
+
+// HMACAuth signs the method, the URI, the time and a random nonce of every request
+// with the secret shared with the server. The secret itself is not sent, the server
+// finds it by KeyID.
+type HMACAuth struct {
+	KeyID  string
+	Secret []byte
+	// now is replaced in tests
+	now func() time.Time
+}
+
+func (a HMACAuth) Authenticate(r *http.Request) error {
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	now := time.Now
+	if a.now != nil {
+		now = a.now
+	}
+
+	timestamp := strconv.FormatInt(now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce[:])
+	r.Header.Set(AuthKeyHeader, a.KeyID)
+	r.Header.Set(AuthTimestampHeader, timestamp)
+	r.Header.Set(AuthNonceHeader, nonceHex)
+	r.Header.Set(AuthSignatureHeader, hmacSignature(a.Secret, r.Method, r.URL.RequestURI(), timestamp, nonceHex))
+	return nil
+}
+
+func (a HMACAuth) identity() string {
+	return a.KeyID
+}
+
+// authIdentity is implemented by authenticators of this package,
+// responses of different identities are cached separately.
+// The identity is the token or the key id, ResponseCache.Invalidate expects it.
+type authIdentity interface {
+	identity() string
+}
+
+// hmacSignature is the hex HMAC-SHA256 of the request parts separated by newlines
+func hmacSignature(secret []byte, method, uri, timestamp, nonce string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{method, uri, timestamp, nonce}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DefaultMaxClockSkew is how far the time of a signed request may be from the server time
+const DefaultMaxClockSkew = 5 * time.Minute
+
+// errors of signature checks, their texts are sent to clients
+var (
+	errBadSignature  = errors.New("Bad signature")
+	errStaleRequest  = errors.New("Stale request")
+	errReplayedNonce = errors.New("Replayed nonce")
+)
+
+type seenNonce struct {
+	nonce string
+	seen  time.Time
+}
+
+// verifySignature checks the HMAC signature of the request and remembers its nonce
+func (srv *SearchServer) verifySignature(r *http.Request) error {
+	secret, ok := srv.HMACKeys[r.Header.Get(AuthKeyHeader)]
+	if !ok {
+		return errBadSignature
+	}
+	timestamp, nonce := r.Header.Get(AuthTimestampHeader), r.Header.Get(AuthNonceHeader)
+	expected := hmacSignature(secret, r.Method, r.URL.RequestURI(), timestamp, nonce)
+	if nonce == "" || !hmac.Equal([]byte(expected), []byte(r.Header.Get(AuthSignatureHeader))) {
+		return errBadSignature
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errBadSignature
+	}
+	skew := srv.MaxClockSkew
+	if skew == 0 {
+		skew = DefaultMaxClockSkew
+	}
+	now := srv.clock()
+	signed := time.Unix(unix, 0)
+	if signed.Before(now.Add(-skew)) || signed.After(now.Add(skew)) {
+		return errStaleRequest
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	// nonces seen two skews ago can't be replayed, their requests are stale by now
+	expired := 0
+	for _, n := range srv.nonceQueue {
+		if !n.seen.Before(now.Add(-2 * skew)) {
+			break
+		}
+		delete(srv.nonces, n.nonce)
+		expired++
+	}
+	srv.nonceQueue = srv.nonceQueue[expired:]
+
+	if _, ok := srv.nonces[nonce]; ok {
+		return errReplayedNonce
+	}
+	if srv.nonces == nil {
+		srv.nonces = make(map[string]time.Time)
+	}
+	srv.nonces[nonce] = now
+	srv.nonceQueue = append(srv.nonceQueue, seenNonce{nonce: nonce, seen: now})
+	return nil
+}
+
+// authenticate checks credentials of the request, the error text is sent to the client.
+// The token may come in the AccessToken header or as a bearer token.
+func (srv *SearchServer) authenticate(r *http.Request) error {
+	if srv.AccessToken == "" && len(srv.HMACKeys) == 0 {
+		return nil
+	}
+	if r.Header.Get(AuthSignatureHeader) != "" {
+		return srv.verifySignature(r)
+	}
+	if srv.AccessToken != "" {
+		if tokenEqual(r.Header.Get("AccessToken"), srv.AccessToken) {
+			return nil
+		}
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") && tokenEqual(auth[len("Bearer "):], srv.AccessToken) {
+			return nil
+		}
+	}
+	return ErrUnauthorized
+}
+
+// tokenEqual compares tokens in constant time, so the time of the check tells nothing about the token
+func tokenEqual(got, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(got), []byte(expected)) == 1
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSearchClientTokenAuth(t *testing.T) {
+	ts := httptest.NewServer(newTestSearchServer(t, "secret"))
+	defer ts.Close()
+
+	cases := []struct {
+		name string
+		sc   *SearchClient
+		ok   bool
+	}{
+		{"default", &SearchClient{AccessToken: "secret"}, true},
+		{"header", &SearchClient{Auth: HeaderAuth{Token: "secret"}}, true},
+		{"bearer", &SearchClient{Auth: BearerAuth{Token: "secret"}}, true},
+		{"wrong bearer", &SearchClient{Auth: BearerAuth{Token: "wrong"}}, false},
+		// Auth replaces AccessToken
+		{"wrong header", &SearchClient{AccessToken: "secret", Auth: HeaderAuth{Token: "wrong"}}, false},
+		{"hmac without keys", &SearchClient{Auth: HMACAuth{KeyID: "ui", Secret: []byte("secret")}}, false},
+	}
+	for _, c := range cases {
+		c.sc.URL = ts.URL
+		_, err := c.sc.FindUsers(SearchRequest{Limit: 1})
+		if c.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+		if !c.ok && !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("%s: expected ErrUnauthorized, got %v", c.name, err)
+		}
+	}
+}
+
+func TestSearchClientHMACAuth(t *testing.T) {
+	srv := newTestSearchServer(t, "")
+	srv.HMACKeys = map[string][]byte{"ui": []byte("ui secret")}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	cases := []struct {
+		name string
+		auth HMACAuth
+		ok   bool
+	}{
+		{"signed", HMACAuth{KeyID: "ui", Secret: []byte("ui secret")}, true},
+		{"clock skew", HMACAuth{KeyID: "ui", Secret: []byte("ui secret"), now: func() time.Time { return time.Now().Add(4 * time.Minute) }}, true},
+		{"wrong secret", HMACAuth{KeyID: "ui", Secret: []byte("guess")}, false},
+		{"unknown key", HMACAuth{KeyID: "gateway", Secret: []byte("ui secret")}, false},
+		{"stale", HMACAuth{KeyID: "ui", Secret: []byte("ui secret"), now: func() time.Time { return time.Now().Add(-10 * time.Minute) }}, false},
+	}
+	for _, c := range cases {
+		sc := &SearchClient{URL: ts.URL, Auth: c.auth}
+		resp, err := sc.FindUsers(SearchRequest{Limit: 2, Query: "Nulla"})
+		if c.ok && (err != nil || len(resp.Users) != 2) {
+			t.Errorf("%s: unexpected result %+v, %v", c.name, resp, err)
+		}
+		if !c.ok && !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("%s: expected ErrUnauthorized, got %v", c.name, err)
+		}
+	}
+
+	// the token does not work for a server with keys only
+	if _, err := (&SearchClient{URL: ts.URL, AccessToken: "ui secret"}).FindUsers(SearchRequest{}); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized for unsigned request, got %v", err)
+	}
+}
+
+func TestSearchServerVerifySignature(t *testing.T) {
+	now := time.Unix(100000, 0)
+	srv := newTestSearchServer(t, "secret")
+	srv.HMACKeys = map[string][]byte{"ui": []byte("ui secret")}
+	srv.now = func() time.Time { return now }
+	auth := HMACAuth{KeyID: "ui", Secret: []byte("ui secret"), now: func() time.Time { return now }}
+
+	signed := func(target string) *http.Request {
+		r := httptest.NewRequest("GET", target, nil)
+		if err := auth.Authenticate(r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	serveError := func(r *http.Request) string {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		if w.Code == http.StatusOK {
+			return ""
+		}
+		errResp := SearchErrorResponse{}
+		json.Unmarshal(w.Body.Bytes(), &errResp)
+		return errResp.Error
+	}
+
+	r := signed("/?limit=1&query=Boyd")
+	if errText := serveError(r); errText != "" {
+		t.Fatalf("signed request failed: %s", errText)
+	}
+	if errText := serveError(r); errText != "Replayed nonce" {
+		t.Errorf("expected replayed nonce, got %q", errText)
+	}
+
+	// the signature covers the query
+	r = signed("/?limit=1&query=Boyd")
+	r.URL.RawQuery = "limit=100&query=Boyd"
+	if errText := serveError(r); errText != "Bad signature" {
+		t.Errorf("expected bad signature, got %q", errText)
+	}
+	r = signed("/?limit=1")
+	r.Header.Set(AuthTimestampHeader, "1")
+	if errText := serveError(r); errText != "Bad signature" {
+		t.Errorf("expected bad signature for changed timestamp, got %q", errText)
+	}
+
+	// the token is still accepted
+	r = httptest.NewRequest("GET", "/?limit=1", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	if errText := serveError(r); errText != "" {
+		t.Errorf("bearer token failed: %s", errText)
+	}
+
+	// old nonces are forgotten
+	for i := 0; i < 3; i++ {
+		serveError(signed("/?limit=1"))
+	}
+	now = now.Add(11 * time.Minute)
+	serveError(signed("/?limit=1"))
+	srv.mu.Lock()
+	nonces, queued := len(srv.nonces), len(srv.nonceQueue)
+	srv.mu.Unlock()
+	if nonces != 1 || queued != 1 {
+		t.Errorf("expected 1 remembered nonce, got %d in the map and %d in the queue", nonces, queued)
+	}
+}
+
+func TestSearchClientHMACRetry(t *testing.T) {
+	srv := newTestSearchServer(t, "")
+	srv.HMACKeys = map[string][]byte{"ui": []byte("ui secret")}
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first request is checked and then fails, so its nonce is used
+		if atomic.AddInt32(&requests, 1) == 1 {
+			srv.ServeHTTP(httptest.NewRecorder(), r)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	sc := &SearchClient{
+		URL:   ts.URL,
+		Auth:  HMACAuth{KeyID: "ui", Secret: []byte("ui secret")},
+		Retry: &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+	}
+	if _, err := sc.FindUsers(SearchRequest{Limit: 1}); err != nil {
+		t.Errorf("the retry must be signed again, got %v", err)
+	}
+}
+
+func TestResponseCacheAuthIdentity(t *testing.T) {
+	var requests, notModified int32
+	ts := cachedServer(t, &requests, &notModified)
+	defer ts.Close()
+
+	cache := NewResponseCache(time.Minute, 0)
+	for _, auth := range []Authenticator{
+		BearerAuth{Token: "first"},
+		BearerAuth{Token: "second"},
+		HMACAuth{KeyID: "ui"},
+		HMACAuth{KeyID: "ui"},
+	} {
+		sc := &SearchClient{URL: ts.URL, Auth: auth, Cache: cache}
+		sc.FindUsers(SearchRequest{Limit: 1})
+	}
+	if stats := cache.Stats(); stats.Misses != 3 || stats.Hits != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	cache.Invalidate("second", SearchRequest{Limit: 1})
+	if stats := cache.Stats(); stats.Entries != 2 {
+		t.Errorf("expected 2 entries after Invalidate, got %+v", stats)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"container/list"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResponseCache keeps successful responses of FindUsers for TTL.
+// Entries are keyed by AccessToken and the request, so one cache may be shared
+// by clients with different tokens. Expired entries with an ETag are revalidated
+// by If-None-Match instead of being downloaded again. When there are MaxEntries
+// of them the least recently used one is evicted.
+type ResponseCache struct {
+	// TTL is how long a response is used without asking the server,
+	// zero revalidates every request
+	TTL time.Duration
+	// MaxEntries bounds the number of responses, zero means no bound
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru has the most recently used entry at the front
+	lru   *list.List
+	stats CacheStats
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// CacheStats are counters of a ResponseCache
+type CacheStats struct {
+	// Hits are responses returned without a request
+	Hits int64
+	// Revalidations are expired responses the server answered 304 Not Modified for
+	Revalidations int64
+	// Misses are requests with the response downloaded
+	Misses    int64
+	Evictions int64
+	Entries   int
+}
+
+type cacheEntry struct {
+	key     string
+	resp    SearchResponse
+	etag    string
+	expires time.Time
+}
+
+// NewResponseCache returns an empty cache
+func NewResponseCache(ttl time.Duration, maxEntries int) *ResponseCache {
+	return &ResponseCache{TTL: ttl, MaxEntries: maxEntries}
+}
+
+// cacheKey is the token with the normalized request, the server ignores
+// offset, filters and order of requests with a cursor
+func cacheKey(accessToken string, req SearchRequest) string {
+	if req.Cursor != "" {
+		req = SearchRequest{Limit: req.Limit, Cursor: req.Cursor}
+	}
+	if req.TermsOp == "" {
+		req.TermsOp = TermsAnd
+	}
+	return strings.Join([]string{
+		accessToken,
+		strconv.Itoa(req.Limit),
+		strconv.Itoa(req.Offset),
+		req.Query,
+		req.OrderField,
+		strconv.Itoa(req.OrderBy),
+		req.QueryField,
+		strings.Join(req.Terms, "\x01"),
+		req.TermsOp,
+		strconv.Itoa(req.AgeMin),
+		strconv.Itoa(req.AgeMax),
+		req.Gender,
+		req.Cursor,
+	}, "\x00")
+}
+
+// copyResponse returns resp with its own slice of users, so callers can't change the cache
+func copyResponse(resp *SearchResponse) *SearchResponse {
+	result := *resp
+	result.Users = append([]User{}, resp.Users...)
+	return &result
+}
+
+// lookup returns a fresh response or the ETag to revalidate an expired one
+func (c *ResponseCache) lookup(key string) (*SearchResponse, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, ""
+	}
+	entry := elem.Value.(*cacheEntry)
+	c.lru.MoveToFront(elem)
+	if c.clock().Before(entry.expires) {
+		c.stats.Hits++
+		return copyResponse(&entry.resp), ""
+	}
+	return nil, entry.etag
+}
+
+// revalidated returns the response the server answered 304 for and extends its TTL.
+// It returns nil if the entry was removed meanwhile.
+func (c *ResponseCache) revalidated(key string) *SearchResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*cacheEntry)
+	entry.expires = c.clock().Add(c.TTL)
+	c.stats.Revalidations++
+	return copyResponse(&entry.resp)
+}
+
+// store saves the downloaded response and counts the miss
+func (c *ResponseCache) store(key string, resp *SearchResponse, etag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Misses++
+	entry := &cacheEntry{
+		key:     key,
+		resp:    *copyResponse(resp),
+		etag:    etag,
+		expires: c.clock().Add(c.TTL),
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+		c.lru = list.New()
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+
+	for c.MaxEntries > 0 && c.lru.Len() > c.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+// Invalidate removes the response of the request made with the token,
+// it is AccessToken, the token of HeaderAuth and BearerAuth or KeyID of HMACAuth
+func (c *ResponseCache) Invalidate(accessToken string, req SearchRequest) {
+	if req.Limit > MaxLimit {
+		req.Limit = MaxLimit
+	}
+	key := cacheKey(accessToken, req)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// Purge removes all responses, the stats are kept
+func (c *ResponseCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+	c.lru = nil
+}
+
+// Stats returns the counters
+func (c *ResponseCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	return stats
+}
+
+func (c *ResponseCache) clock() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cachedServer is SearchServer counting requests and 304 responses
+func cachedServer(t *testing.T, requests, notModified *int32) *httptest.Server {
+	srv := newTestSearchServer(t, "")
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, r)
+		if rec.Code == http.StatusNotModified {
+			atomic.AddInt32(notModified, 1)
+		}
+		for name, values := range rec.Header() {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}))
+}
+
+func TestResponseCacheHits(t *testing.T) {
+	var requests, notModified int32
+	ts := cachedServer(t, &requests, &notModified)
+	defer ts.Close()
+
+	cache := NewResponseCache(time.Minute, 10)
+	sc := &SearchClient{URL: ts.URL, Cache: cache}
+	req := SearchRequest{Limit: 2, Query: "Nulla", OrderField: "Id", OrderBy: OrderByAsc}
+
+	first, err := sc.FindUsers(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first.Users[0].Name = "changed by the caller"
+	second, err := sc.FindUsers(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if second.Users[0].Name == "changed by the caller" || !second.NextPage || second.NextCursor == "" {
+		t.Errorf("unexpected cached response %+v", second)
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("expected 1 request, got %d", atomic.LoadInt32(&requests))
+	}
+
+	// limits over MaxLimit are the same request
+	sc.FindUsers(SearchRequest{Limit: 100})
+	sc.FindUsers(SearchRequest{Limit: MaxLimit})
+	// another token is another entry
+	other := &SearchClient{URL: ts.URL, Cache: cache, AccessToken: "other"}
+	other.FindUsers(req)
+
+	expected := CacheStats{Hits: 2, Misses: 3, Entries: 3}
+	if stats := cache.Stats(); stats != expected {
+		t.Errorf("got stats %+v, expected %+v", stats, expected)
+	}
+	if atomic.LoadInt32(&requests) != 3 {
+		t.Errorf("expected 3 requests, got %d", atomic.LoadInt32(&requests))
+	}
+}
+
+func TestResponseCacheRevalidation(t *testing.T) {
+	var requests, notModified int32
+	ts := cachedServer(t, &requests, &notModified)
+	defer ts.Close()
+
+	now := time.Unix(1000, 0)
+	cache := NewResponseCache(time.Minute, 0)
+	cache.now = func() time.Time { return now }
+	sc := &SearchClient{URL: ts.URL, Cache: cache}
+	req := SearchRequest{Limit: 3, Offset: 3}
+
+	expected, _ := sc.FindUsers(req)
+	now = now.Add(59 * time.Second)
+	sc.FindUsers(req)
+	now = now.Add(2 * time.Second)
+	resp, err := sc.FindUsers(req)
+	if err != nil || !reflect.DeepEqual(resp, expected) {
+		t.Errorf("revalidated %+v, %v, expected %+v", resp, err, expected)
+	}
+	// the TTL starts again after revalidation
+	now = now.Add(30 * time.Second)
+	sc.FindUsers(req)
+
+	if atomic.LoadInt32(&requests) != 2 || atomic.LoadInt32(&notModified) != 1 {
+		t.Errorf("expected 2 requests with one 304, got %d with %d", atomic.LoadInt32(&requests), atomic.LoadInt32(&notModified))
+	}
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Revalidations != 1 || stats.Misses != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// entries without ETag are downloaded again
+	ts2 := httptest.NewServer(http.HandlerFunc(handlerTestServer))
+	defer ts2.Close()
+	sc.URL = ts2.URL
+	sc.FindUsers(SearchRequest{Limit: 1})
+	now = now.Add(2 * time.Minute)
+	sc.FindUsers(SearchRequest{Limit: 1})
+	if stats := cache.Stats(); stats.Misses != 3 || stats.Revalidations != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	var requests, notModified int32
+	ts := cachedServer(t, &requests, &notModified)
+	defer ts.Close()
+
+	cache := NewResponseCache(time.Minute, 2)
+	sc := &SearchClient{URL: ts.URL, Cache: cache}
+	sc.FindUsers(SearchRequest{Limit: 1})
+	sc.FindUsers(SearchRequest{Limit: 2})
+	// the first one becomes the recent one, so the second is evicted
+	sc.FindUsers(SearchRequest{Limit: 1})
+	sc.FindUsers(SearchRequest{Limit: 3})
+	atomic.StoreInt32(&requests, 0)
+
+	sc.FindUsers(SearchRequest{Limit: 1})
+	sc.FindUsers(SearchRequest{Limit: 3})
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Errorf("expected cached responses, got %d requests", atomic.LoadInt32(&requests))
+	}
+	sc.FindUsers(SearchRequest{Limit: 2})
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("expected evicted response to be requested, got %d requests", atomic.LoadInt32(&requests))
+	}
+	if stats := cache.Stats(); stats.Entries != 2 || stats.Evictions != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestResponseCacheInvalidate(t *testing.T) {
+	var requests, notModified int32
+	ts := cachedServer(t, &requests, &notModified)
+	defer ts.Close()
+
+	cache := NewResponseCache(time.Minute, 0)
+	sc := &SearchClient{URL: ts.URL, Cache: cache}
+	first, _ := sc.FindUsers(SearchRequest{Limit: 2})
+	sc.FindUsers(SearchRequest{Limit: 2, Cursor: first.NextCursor})
+
+	// the cursor replaces the other fields
+	cache.Invalidate("", SearchRequest{Limit: 2, Query: "ignored", Cursor: first.NextCursor})
+	if stats := cache.Stats(); stats.Entries != 1 {
+		t.Errorf("expected 1 entry after Invalidate, got %+v", stats)
+	}
+	sc.FindUsers(SearchRequest{Limit: 2, Cursor: first.NextCursor})
+	if atomic.LoadInt32(&requests) != 3 {
+		t.Errorf("expected invalidated response to be requested, got %d requests", atomic.LoadInt32(&requests))
+	}
+
+	cache.Purge()
+	if stats := cache.Stats(); stats.Entries != 0 || stats.Misses != 3 {
+		t.Errorf("unexpected stats after Purge %+v", stats)
+	}
+	sc.FindUsers(SearchRequest{Limit: 2})
+	if atomic.LoadInt32(&requests) != 4 {
+		t.Errorf("expected purged response to be requested, got %d requests", atomic.LoadInt32(&requests))
+	}
+}
+
+func TestResponseCacheEvictedDuringRevalidation(t *testing.T) {
+	srv := newTestSearchServer(t, "")
+	cache := NewResponseCache(0, 0)
+	var requests, notModified int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&notModified) > 0 {
+			// the entry is evicted while the server answers 304 to everything
+			cache.Purge()
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	sc := &SearchClient{URL: ts.URL, Cache: cache}
+	if _, err := sc.FindUsers(SearchRequest{Limit: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	atomic.StoreInt32(&notModified, 1)
+	_, err := sc.FindUsers(SearchRequest{Limit: 2})
+	if serverErr, ok := err.(ErrServer); !ok || serverErr.Status != http.StatusNotModified {
+		t.Errorf("expected ErrServer with 304, got %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("expected a single request without If-None-Match, got %d requests", n)
+	}
+}
+
+func TestResponseCacheSkipsErrors(t *testing.T) {
+	var requests int32
+	ts := flakyServer(1, http.StatusInternalServerError, &requests)
+	defer ts.Close()
+
+	cache := NewResponseCache(time.Minute, 0)
+	sc := &SearchClient{URL: ts.URL, Cache: cache}
+	if _, err := sc.FindUsers(SearchRequest{Limit: 1}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if resp, err := sc.FindUsers(SearchRequest{Limit: 1}); err != nil || len(resp.Users) != 1 {
+		t.Errorf("unexpected result %+v, %v", resp, err)
+	}
+	if stats := cache.Stats(); stats.Entries != 1 || stats.Misses != 1 || stats.Hits != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCacheKeyFilters(t *testing.T) {
+	base := SearchRequest{Limit: 5, Query: "a"}
+	keys := map[string]bool{cacheKey("", base): true}
+	for _, req := range []SearchRequest{
+		{Limit: 5, Query: "a", QueryField: "Name"},
+		{Limit: 5, Query: "a", Terms: []string{"b"}},
+		{Limit: 5, Query: "a", Terms: []string{"b"}, TermsOp: TermsOr},
+		{Limit: 5, Query: "a", AgeMin: 20},
+		{Limit: 5, Query: "a", AgeMax: 20},
+		{Limit: 5, Query: "a", Gender: "male"},
+	} {
+		key := cacheKey("", req)
+		if keys[key] {
+			t.Errorf("%+v has the key of another request", req)
+		}
+		keys[key] = true
+	}
+
+	// the default operator is TermsAnd
+	if cacheKey("", SearchRequest{Terms: []string{"b"}}) != cacheKey("", SearchRequest{Terms: []string{"b"}, TermsOp: TermsAnd}) {
+		t.Error("empty TermsOp differs from TermsAnd")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -19,9 +20,14 @@ const (
 
 var (
 	errTest = errors.New("testing")
-	client  = &http.Client{Timeout: time.Second}
 )
 
+// MaxLimit is the largest page FindUsers returns, use Iterate to get more users
+const MaxLimit = 25
+
+// DefaultTimeout limits requests of a SearchClient without its own HTTPClient and Timeout
+const DefaultTimeout = time.Second
+
 type User struct {
 	Id     int
 	Name   string
@@ -33,6 +39,8 @@ type User struct {
 type SearchResponse struct {
 	Users    []User
 	NextPage bool
+	// NextCursor is the cursor of the next page if the server supports cursors
+	NextCursor string
 }
 
 type SearchErrorResponse struct {
@@ -47,36 +55,158 @@ const (
 	ErrorBadOrderField = `OrderField invalid`
 )
 
+// operators of SearchRequest.Terms
+const (
+	TermsAnd = "and"
+	TermsOr  = "or"
+)
+
+// NextCursorHeader is the response header with the cursor of the next page.
+// A server returns limit users of the page and one more if there is the next page,
+// a server supporting cursors sets the header then.
+const NextCursorHeader = "X-Next-Cursor"
+
 type SearchRequest struct {
-	Limit      int
-	Offset     int    // Можно учесть после сортировки
+	Limit int
+	// Offset is the number of users skipped after sorting, not the number of the page:
+	// the page after Limit: 10, Offset: 20 is Offset: 30
+	Offset     int
 	Query      string // подстрока в 1 из полей
 	OrderField string
 	OrderBy    int // -1 по убыванию, 0 как встретилось, 1 по возрастанию
+
+	// QueryField is the field Query and Terms are searched in: Name or About, both if empty
+	QueryField string
+	// Terms are substrings like Query, all of them must be found or any if TermsOp is TermsOr
+	Terms   []string
+	TermsOp string
+	// AgeMin and AgeMax are inclusive bounds of the age, zero AgeMax means no upper bound
+	AgeMin int
+	AgeMax int
+	// Gender is male or female, any if empty
+	Gender string
+
+	// Cursor is SearchResponse.NextCursor of the previous page,
+	// the server takes offset, filters and order from it instead of the fields above
+	Cursor string
 }
 
 type SearchClient struct {
 	AccessToken string // токен, по которому происходит авторизация на внешней системе, уходит туда через хедер
 	URL         string // урл внешней системы, куда идти
+
+	// HTTPClient is used as is if it is set, Timeout and Transport are ignored then
+	HTTPClient *http.Client
+	// Timeout limits a whole request including reading the body, DefaultTimeout if zero.
+	// Every retry has its own timeout.
+	Timeout time.Duration
+	// Transport makes requests, http.DefaultTransport if nil
+	Transport http.RoundTripper
+
+	// Retry repeats requests failed by timeouts, temporary network errors and 5xx responses, nil disables retries
+	Retry *RetryPolicy
+	// Breaker fails requests fast while the server is unhealthy, nil disables it
+	Breaker *CircuitBreaker
+	// Auth adds credentials to requests, HeaderAuth with AccessToken if nil
+	Auth Authenticator
+	// Cache keeps responses of FindUsers, nil disables caching.
+	// Responses of a custom Auth are cached by AccessToken.
+	Cache *ResponseCache
+}
+
+func (srv *SearchClient) authenticator() Authenticator {
+	if srv.Auth == nil {
+		return HeaderAuth{Token: srv.AccessToken}
+	}
+	return srv.Auth
+}
+
+// cacheIdentity separates cached responses of different credentials
+func (srv *SearchClient) cacheIdentity() string {
+	if auth, ok := srv.authenticator().(authIdentity); ok {
+		return auth.identity()
+	}
+	return srv.AccessToken
+}
+
+// httpClient returns the client for requests made with the settings of srv
+func (srv *SearchClient) httpClient() *http.Client {
+	if srv.HTTPClient != nil {
+		return srv.HTTPClient
+	}
+	timeout := srv.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return &http.Client{Timeout: timeout, Transport: srv.Transport}
+}
+
+// sendOnce makes a single request with additional headers and reads the response
+func (srv *SearchClient) sendOnce(ctx context.Context, searcherParams url.Values, header http.Header) (int, http.Header, []byte, error) {
+	// Формирование GET запроса
+	searcherReq, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"?"+searcherParams.Encode(), nil)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("unknown error %w", err)
+	}
+	for name, values := range header {
+		searcherReq.Header[name] = values
+	}
+	if err := srv.authenticator().Authenticate(searcherReq); err != nil {
+		return 0, nil, nil, fmt.Errorf("cant authenticate request: %w", err)
+	}
+
+	resp, err := srv.httpClient().Do(searcherReq)
+	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return 0, nil, nil, &timeoutError{params: searcherParams.Encode(), err: err}
+		}
+		return 0, nil, nil, fmt.Errorf("unknown error %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("unknown error %w", err)
+	}
+	return resp.StatusCode, resp.Header, body, nil
 }
 
 // FindUsers отправляет запрос во внешнюю систему, которая непосредственно ищет пользоваталей
 func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
+	return srv.FindUsersContext(context.Background(), req)
+}
+
+// FindUsersContext is FindUsers with the context of the request,
+// cancellation of the context aborts the request
+func (srv *SearchClient) FindUsersContext(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
 
 	// Проверка входных параметров
 	if req.Limit < 0 {
 		return nil, fmt.Errorf("limit must be > 0")
 	}
-	if req.Limit > 25 {
-		req.Limit = 25
+	if req.Limit > MaxLimit {
+		req.Limit = MaxLimit
 	}
 	if req.Offset < 0 {
 		return nil, fmt.Errorf("offset must be > 0")
 	}
 
-	// Нужно для получения следующей записи, на основе которой мы скажем - можно показать переключатель следующей страницы или нет
-	// req.Offset++
-	// req.Limit
+	// Ответ из кеша, устаревший ответ с ETag проверяется на сервере
+	var key string
+	reqHeader := http.Header{}
+	if srv.Cache != nil {
+		key = cacheKey(srv.cacheIdentity(), req)
+		resp, etag := srv.Cache.lookup(key)
+		if resp != nil {
+			return resp, nil
+		}
+		if etag != "" {
+			reqHeader.Set("If-None-Match", etag)
+		}
+	}
+
+	// Сервер отдаёт одну страницу: пропускает offset пользователей и берёт limit+1,
+	// лишняя запись говорит, что есть следующая страница, курсор на неё может прийти в хедере
 
 	// Формирование параметров запроса URL
 	searcherParams := url.Values{}
@@ -85,40 +215,67 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 	searcherParams.Add("query", req.Query)
 	searcherParams.Add("order_field", req.OrderField)
 	searcherParams.Add("order_by", strconv.Itoa(req.OrderBy))
+	// фильтры передаются только если заданы
+	if req.QueryField != "" {
+		searcherParams.Add("query_field", req.QueryField)
+	}
+	for _, term := range req.Terms {
+		searcherParams.Add("term", term)
+	}
+	if req.TermsOp != "" {
+		searcherParams.Add("terms_op", req.TermsOp)
+	}
+	if req.AgeMin != 0 {
+		searcherParams.Add("age_min", strconv.Itoa(req.AgeMin))
+	}
+	if req.AgeMax != 0 {
+		searcherParams.Add("age_max", strconv.Itoa(req.AgeMax))
+	}
+	if req.Gender != "" {
+		searcherParams.Add("gender", req.Gender)
+	}
+	if req.Cursor != "" {
+		searcherParams.Add("cursor", req.Cursor)
+	}
 
-	// Формирование GET запроса
-	searcherReq, err := http.NewRequest("GET", srv.URL+"?"+searcherParams.Encode(), nil)
-	searcherReq.Header.Add("AccessToken", srv.AccessToken)
-
-	// Выполенение запроса.
-	// Ответ структура body
-	// client - глобальная переменная &http.Client
-	resp, err := client.Do(searcherReq)
+	// Выполенение запроса, с повторами если они настроены
+	status, header, body, err := srv.send(ctx, searcherParams, reqHeader)
 	if err != nil {
-		if err, ok := err.(net.Error); ok && err.Timeout() {
-			return nil, fmt.Errorf("timeout for %s", searcherParams.Encode())
+		return nil, err
+	}
+
+	if status == http.StatusNotModified && reqHeader.Get("If-None-Match") != "" {
+		if resp := srv.Cache.revalidated(key); resp != nil {
+			return resp, nil
+		}
+		// the entry was evicted during the request, the page is downloaded once more
+		reqHeader.Del("If-None-Match")
+		status, header, body, err = srv.send(ctx, searcherParams, reqHeader)
+		if err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("unknown error %s", err)
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	if status == http.StatusNotModified {
+		// nothing was asked to revalidate
+		return nil, ErrServer{Status: status}
+	}
 
 	// Возврат ошибки если стутус равен ошибке
-	switch resp.StatusCode {
-	case http.StatusUnauthorized:
-		return nil, fmt.Errorf("Bad AccessToken")
-	case http.StatusInternalServerError:
-		return nil, fmt.Errorf("SearchServer fatal error")
-	case http.StatusBadRequest:
+	switch {
+	case status == http.StatusUnauthorized:
+		return nil, ErrUnauthorized
+	case status >= http.StatusInternalServerError:
+		return nil, ErrServer{Status: status}
+	case status == http.StatusBadRequest:
 		errResp := SearchErrorResponse{}
 		err = json.Unmarshal(body, &errResp)
 		if err != nil {
-			return nil, fmt.Errorf("cant unpack error json: %s", err)
+			return nil, ErrDecode{What: "error", Err: err}
 		}
 		if errResp.Error == "ErrorBadOrderField" {
-			return nil, fmt.Errorf("OrderField %s invalid", req.OrderField)
+			return nil, ErrBadOrderField{Field: req.OrderField}
 		}
-		return nil, fmt.Errorf("unknown bad request error: %s", errResp.Error)
+		return nil, ErrBadRequest{Reason: errResp.Error}
 	}
 
 	// transform data to a User structure
@@ -126,17 +283,18 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 	data := []User{}
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		return nil, fmt.Errorf("cant unpack result json: %s", err)
+		return nil, ErrDecode{What: "result", Err: err}
 	}
 
 	// Формирование результата
-	result := SearchResponse{}
-	// if we are dealing with not last element
-	if len(data) >= req.Limit*(req.Offset+1) {
+	result := SearchResponse{Users: data}
+	if len(data) > req.Limit {
 		result.NextPage = true
-		result.Users = data[req.Limit*req.Offset : req.Limit*(req.Offset+1)]
-	} else {
-		result.Users = data[0:len(data)]
+		result.Users = data[:req.Limit]
+		result.NextCursor = header.Get(NextCursorHeader)
+	}
+	if srv.Cache != nil {
+		srv.Cache.store(key, &result, header.Get("ETag"))
 	}
 
 	return &result, err
@@ -1,13 +1,12 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"encoding/xml"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"reflect"
 	"strconv"
 	"strings"
@@ -15,62 +14,6 @@ import (
 	"time"
 )
 
-type Row struct {
-	ID            int    `xml:"id"`
-	GUID          string `xml:"guid"`
-	IsActive      bool   `xml:"isActive"`
-	Balance       string `xml:"balance"`
-	Picture       string `xml:"picture"`
-	Age           int    `xml:"age"`
-	EyeColor      string `xml:"eyeColor"`
-	FirstName     string `xml:"first_name"`
-	LastName      string `xml:"last_name"`
-	Gender        string `xml:"gender"`
-	Company       string `xml:"company"`
-	Email         string `xml:"email"`
-	Phone         string `xml:"phone"`
-	About         string `xml:"about"`
-	Registered    string `xml:"registered"`
-	FavoriteFruit string `xml:"favoriteFruit"`
-}
-
-type Rows struct {
-	Version string `xml:"version,attr"`
-	List    []Row  `xml:"row"`
-}
-
-// create []User from dataset.xml
-func usersFromXML(fileName string) ([]User, error) {
-	// open xml file
-	xmlFile, err := os.Open(fileName)
-	if err != nil {
-		return nil, err
-	}
-	defer xmlFile.Close()
-
-	// read xml into Rows structure
-	rows := new(Rows)
-	byteValue, _ := ioutil.ReadAll(xmlFile)
-	err = xml.Unmarshal(byteValue, &rows)
-	if err != nil {
-		return nil, err
-	}
-
-	// create and fullfil []User
-	users := make([]User, 0)
-	for _, row := range rows.List {
-		user := User{
-			Id:     row.ID,
-			Name:   row.FirstName + " " + row.LastName,
-			Age:    row.Age,
-			About:  row.About,
-			Gender: row.Gender,
-		}
-		users = append(users, user)
-	}
-	return users, nil
-}
-
 // Handles request from SearchClient
 func handlerTestServer(w http.ResponseWriter, r *http.Request) {
 
@@ -109,6 +52,17 @@ func handlerTestServer(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// the page after offset with one more user telling there is the next page,
+	// SearchServer answers the same way
+	if sr.Offset < len(outputUsers) {
+		outputUsers = outputUsers[sr.Offset:]
+	} else {
+		outputUsers = outputUsers[:0]
+	}
+	if sr.Limit+1 < len(outputUsers) {
+		outputUsers = outputUsers[:sr.Limit+1]
+	}
+
 	// outputUsers -> json
 	resultJSON, err := json.Marshal(outputUsers)
 
@@ -148,16 +102,9 @@ func TestSearchClientUserSearch(t *testing.T) {
 				},
 			},
 			Result: &TestResult{
+				// Offset counts users, not pages, so the only found user is skipped
 				sr: &SearchResponse{
-					Users: []User{
-						User{
-							Id:     0,
-							Name:   "Boyd Wolf",
-							Age:    22,
-							Gender: "male",
-							About:  "Nulla cillum enim voluptate consequat laborum esse excepteur occaecat commodo nostrud excepteur ut cupidatat. Occaecat minim incididunt ut proident ad sint nostrud ad laborum sint pariatur. Ut nulla commodo dolore officia. Consequat anim eiusmod amet commodo eiusmod deserunt culpa. Ea sit dolore nostrud cillum proident nisi mollit est Lorem pariatur. Lorem aute officia deserunt dolor nisi aliqua consequat nulla nostrud ipsum irure id deserunt dolore. Minim reprehenderit nulla exercitation labore ipsum.\n",
-						},
-					},
+					Users:    []User{},
 					NextPage: false,
 				},
 				err: nil,
@@ -233,7 +180,7 @@ func TestSearchClientWithFakeServer(t *testing.T) {
 			sr: &SearchRequest{},
 		},
 		Result: &TestResult{
-			err: fmt.Errorf("unknown error Get bad_link?limit=0&offset=0&order_by=0&order_field=&query=: unsupported protocol scheme \"\""),
+			err: fmt.Errorf("unknown error Get \"bad_link?limit=0&offset=0&order_by=0&order_field=&query=\": unsupported protocol scheme \"\""),
 		},
 	}
 
@@ -245,7 +192,7 @@ func TestSearchClientWithFakeServer(t *testing.T) {
 
 	if err != nil && tc.Result.err != nil {
 		// if !strings.Contains(err.Error(), tc.Result.err.Error()) {
-		if !reflect.DeepEqual(tc.Result.err, err) {
+		if err.Error() != tc.Result.err.Error() {
 
 			t.Errorf("[%d] wrong error, expected %#v, got %#v", 0, tc.Result.err, err)
 		}
@@ -277,7 +224,7 @@ func TestSearchClientUnauthorized(t *testing.T) {
 	}
 
 	if err != nil && tc.Result.err != nil && sr == nil {
-		if !reflect.DeepEqual(tc.Result.err, err) {
+		if err.Error() != tc.Result.err.Error() {
 			// if err != tc.Result.err {
 			t.Errorf("Wrong error, expected %#v, got %#v", tc.Result.err, err)
 		}
@@ -309,7 +256,7 @@ func TestSearchClientTimeout(t *testing.T) {
 	}
 
 	if err != nil && tc.Result.err != nil && sr == nil {
-		if !reflect.DeepEqual(tc.Result.err, err) {
+		if err.Error() != tc.Result.err.Error() {
 			// if err != tc.Result.err {
 			t.Errorf("Wrong error, expected %#v, got %#v", tc.Result.err, err)
 		}
@@ -341,7 +288,7 @@ func TestSearchClientStatusInternalServerError(t *testing.T) {
 	}
 
 	if err != nil && tc.Result.err != nil && sr == nil {
-		if !reflect.DeepEqual(tc.Result.err, err) {
+		if err.Error() != tc.Result.err.Error() {
 			// if err != tc.Result.err {
 			t.Errorf("Wrong error, expected %#v, got %#v", tc.Result.err, err)
 		}
@@ -374,7 +321,7 @@ func TestSearchClientStatusInternalLimitError(t *testing.T) {
 	}
 
 	if err != nil && tc.Result.err != nil && sr == nil {
-		if !reflect.DeepEqual(tc.Result.err, err) {
+		if err.Error() != tc.Result.err.Error() {
 			// if err != tc.Result.err {
 			t.Errorf("Wrong error, expected %#v, got %#v", tc.Result.err, err)
 		}
@@ -407,7 +354,7 @@ func TestSearchClientStatusInternalOffsetError(t *testing.T) {
 	}
 
 	if err != nil && tc.Result.err != nil && sr == nil {
-		if !reflect.DeepEqual(tc.Result.err, err) {
+		if err.Error() != tc.Result.err.Error() {
 			// if err != tc.Result.err {
 			t.Errorf("Wrong error, expected %#v, got %#v", tc.Result.err, err)
 		}
@@ -443,7 +390,7 @@ func TestSearchClientStatusInternalBadJSON(t *testing.T) {
 	}
 
 	if err != nil && tc.Result.err != nil && sr == nil {
-		if !reflect.DeepEqual(tc.Result.err, err) {
+		if err.Error() != tc.Result.err.Error() {
 			// if err != tc.Result.err {
 			t.Errorf("Wrong error, expected %#v, got %#v", tc.Result.err, err)
 		}
@@ -490,7 +437,7 @@ func TestSearchClientStatusInternalOrderFieldError(t *testing.T) {
 	}
 
 	if err != nil && tc.Result.err != nil && sr == nil {
-		if !reflect.DeepEqual(tc.Result.err, err) {
+		if err.Error() != tc.Result.err.Error() {
 			// if err != tc.Result.err {
 			t.Errorf("Wrong error, expected %#v, got %#v", tc.Result.err, err)
 		}
@@ -526,7 +473,7 @@ func TestSearchClientStatusInternalStatusBadRequestBadJSON(t *testing.T) {
 	}
 
 	if err != nil && tc.Result.err != nil && sr == nil {
-		if !reflect.DeepEqual(tc.Result.err, err) {
+		if err.Error() != tc.Result.err.Error() {
 			// if err != tc.Result.err {
 			t.Errorf("Wrong error, expected %#v, got %#v", tc.Result.err, err)
 		}
@@ -560,9 +507,124 @@ func TestSearchClientStatusInternalUnknowBadRequestError(t *testing.T) {
 	sr, err := tc.Input.sc.FindUsers(*tc.Input.sr)
 
 	if err != nil && tc.Result.err != nil && sr == nil {
-		if !reflect.DeepEqual(tc.Result.err, err) {
+		if err.Error() != tc.Result.err.Error() {
 			// if err != tc.Result.err {
 			t.Errorf("Wrong error, expected %#v, got %#v", tc.Result.err, err)
 		}
 	}
 }
+
+func TestSearchClientContextCanceled(t *testing.T) {
+	canceled := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(canceled)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	sc := &SearchClient{URL: ts.URL, Timeout: time.Minute}
+	sr, err := sc.FindUsersContext(ctx, SearchRequest{})
+	if err == nil || sr != nil {
+		t.Fatalf("expected an error, got %#v", sr)
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("cancellation did not reach the server")
+	}
+}
+
+func TestSearchClientOwnTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("[]"))
+	}))
+	defer ts.Close()
+
+	// clients with different settings work side by side
+	fast := &SearchClient{URL: ts.URL, Timeout: 20 * time.Millisecond}
+	patient := &SearchClient{URL: ts.URL, HTTPClient: &http.Client{Timeout: 5 * time.Second}}
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := fast.FindUsers(SearchRequest{})
+		errs <- err
+	}()
+	_, err := patient.FindUsers(SearchRequest{})
+	if err != nil {
+		t.Errorf("unexpected error of the patient client: %v", err)
+	}
+
+	expected := "timeout for limit=0&offset=0&order_by=0&order_field=&query="
+	if err := <-errs; err == nil || err.Error() != expected {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+}
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestSearchClientTransport(t *testing.T) {
+	var token string
+	sc := &SearchClient{
+		AccessToken: "secret",
+		URL:         "http://search.invalid/",
+		Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			token = r.Header.Get("AccessToken")
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(strings.NewReader(`[{"Id":7,"Name":"Jane Doe"}]`)),
+				Request:    r,
+			}, nil
+		}),
+	}
+
+	sr, err := sc.FindUsers(SearchRequest{Limit: 5})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token != "secret" {
+		t.Errorf("token %q did not reach the transport", token)
+	}
+	if len(sr.Users) != 1 || sr.Users[0].Id != 7 {
+		t.Errorf("unexpected users %#v", sr.Users)
+	}
+}
+
+func TestSearchClientFilterParams(t *testing.T) {
+	var query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Write([]byte("[]"))
+	}))
+	defer ts.Close()
+
+	sc := &SearchClient{URL: ts.URL}
+	sc.FindUsers(SearchRequest{
+		Limit:      3,
+		Query:      "q",
+		QueryField: "About",
+		Terms:      []string{"a b", "c"},
+		TermsOp:    TermsOr,
+		AgeMin:     20,
+		AgeMax:     30,
+		Gender:     "female",
+	})
+	expected := "age_max=30&age_min=20&gender=female&limit=3&offset=0&order_by=0&order_field=&query=q&query_field=About&term=a+b&term=c&terms_op=or"
+	if query != expected {
+		t.Errorf("got query\n%s\nexpected\n%s", query, expected)
+	}
+
+	// requests without filters are the same as before
+	sc.FindUsers(SearchRequest{Limit: 3})
+	if expected := "limit=3&offset=0&order_by=0&order_field=&query="; query != expected {
+		t.Errorf("got query %s, expected %s", query, expected)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// errors returned by FindUsers keep the texts of the former fmt.Errorf ones,
+// check them with errors.Is and errors.As instead of the text
+
+// ErrUnauthorized means the server did not accept AccessToken
+var ErrUnauthorized = errors.New("Bad AccessToken")
+
+// ErrTimeout matches errors of requests not finished in SearchClient.Timeout
+var ErrTimeout = errors.New("timeout")
+
+// timeoutError is "timeout for <query parameters>" matching ErrTimeout
+type timeoutError struct {
+	params string
+	err    error
+}
+
+func (e *timeoutError) Error() string {
+	return "timeout for " + e.params
+}
+
+func (e *timeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+func (e *timeoutError) Unwrap() error {
+	return e.err
+}
+
+// Timeout and Temporary make the error look like a net.Error
+func (e *timeoutError) Timeout() bool {
+	return true
+}
+
+func (e *timeoutError) Temporary() bool {
+	return true
+}
+
+// ErrBadOrderField means the server can't order users by Field
+type ErrBadOrderField struct {
+	Field string
+}
+
+func (e ErrBadOrderField) Error() string {
+	return fmt.Sprintf("OrderField %s invalid", e.Field)
+}
+
+// ErrServer is a 5xx response of the server or a 304 one to a request without If-None-Match
+type ErrServer struct {
+	Status int
+}
+
+func (e ErrServer) Error() string {
+	if e.Status == http.StatusInternalServerError {
+		return "SearchServer fatal error"
+	}
+	return fmt.Sprintf("SearchServer fatal error: %d %s", e.Status, http.StatusText(e.Status))
+}
+
+// ErrBadRequest is a 400 response with a reason the client does not know
+type ErrBadRequest struct {
+	Reason string
+}
+
+func (e ErrBadRequest) Error() string {
+	return "unknown bad request error: " + e.Reason
+}
+
+// ErrDecode means a response body is not the expected JSON,
+// What is "result" for users and "error" for an error response
+type ErrDecode struct {
+	What string
+	Err  error
+}
+
+func (e ErrDecode) Error() string {
+	return fmt.Sprintf("cant unpack %s json: %s", e.What, e.Err)
+}
+
+func (e ErrDecode) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// statusServer answers every request with the status and the body
+func statusServer(status int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+}
+
+func TestSearchClientErrorTypes(t *testing.T) {
+	ts := statusServer(http.StatusUnauthorized, "")
+	_, err := (&SearchClient{URL: ts.URL}).FindUsers(SearchRequest{})
+	ts.Close()
+	if !errors.Is(err, ErrUnauthorized) || err.Error() != "Bad AccessToken" {
+		t.Errorf("expected ErrUnauthorized, got %#v", err)
+	}
+
+	ts = statusServer(http.StatusBadRequest, `{"Error":"ErrorBadOrderField"}`)
+	_, err = (&SearchClient{URL: ts.URL}).FindUsers(SearchRequest{OrderField: "About"})
+	ts.Close()
+	orderErr := ErrBadOrderField{}
+	if !errors.As(err, &orderErr) || orderErr.Field != "About" {
+		t.Errorf("expected ErrBadOrderField, got %#v", err)
+	}
+
+	ts = statusServer(http.StatusBadRequest, `{"Error":"ErrorBadLimit"}`)
+	_, err = (&SearchClient{URL: ts.URL}).FindUsers(SearchRequest{})
+	ts.Close()
+	badRequest := ErrBadRequest{}
+	if !errors.As(err, &badRequest) || badRequest.Reason != "ErrorBadLimit" {
+		t.Errorf("expected ErrBadRequest, got %#v", err)
+	}
+
+	for _, status := range []int{http.StatusInternalServerError, http.StatusBadGateway} {
+		ts = statusServer(status, "")
+		_, err = (&SearchClient{URL: ts.URL}).FindUsers(SearchRequest{})
+		ts.Close()
+		serverErr := ErrServer{}
+		if !errors.As(err, &serverErr) || serverErr.Status != status {
+			t.Errorf("%d: expected ErrServer, got %#v", status, err)
+		}
+	}
+	if err.Error() != "SearchServer fatal error: 502 Bad Gateway" {
+		t.Errorf("unexpected message %q", err)
+	}
+
+	ts = statusServer(http.StatusOK, "[{}]{}")
+	_, err = (&SearchClient{URL: ts.URL}).FindUsers(SearchRequest{})
+	ts.Close()
+	decodeErr := ErrDecode{}
+	if !errors.As(err, &decodeErr) || decodeErr.What != "result" {
+		t.Errorf("expected ErrDecode, got %#v", err)
+	}
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("expected json.SyntaxError inside, got %#v", err)
+	}
+}
+
+func TestSearchClientErrorTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	_, err := (&SearchClient{URL: ts.URL, Timeout: 10 * time.Millisecond}).FindUsers(SearchRequest{})
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %#v", err)
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("expected a net.Error with Timeout, got %#v", err)
+	}
+	if errors.Is(err, ErrUnauthorized) {
+		t.Errorf("timeout matches ErrUnauthorized")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+)
+
+// UserIterator streams users of a search page by page:
+//
+//	it := client.Iterate(ctx, SearchRequest{Query: "Nulla"}, 0)
+//	for it.Next() {
+//		user := it.User()
+//	}
+//	if err := it.Err(); err != nil {
+//
+// It is not safe for concurrent use.
+type UserIterator struct {
+	client *SearchClient
+	ctx    context.Context
+	// req is the request of the next page
+	req SearchRequest
+	max int
+
+	page     []User
+	pos      int
+	count    int
+	nextPage bool
+	user     User
+	err      error
+}
+
+// Iterate returns an iterator over all pages of the search starting from req.Offset.
+// Limit is the page size, MaxLimit if it is zero. Max > 0 stops after max users.
+func (srv *SearchClient) Iterate(ctx context.Context, req SearchRequest, max int) *UserIterator {
+	if req.Limit == 0 || req.Limit > MaxLimit {
+		req.Limit = MaxLimit
+	}
+	return &UserIterator{
+		client:   srv,
+		ctx:      ctx,
+		req:      req,
+		max:      max,
+		nextPage: true,
+	}
+}
+
+// Next moves to the next user requesting the next page if needed.
+// It returns false after the last user, the max count or an error.
+func (it *UserIterator) Next() bool {
+	if it.err != nil || (it.max > 0 && it.count >= it.max) {
+		return false
+	}
+
+	for it.pos >= len(it.page) {
+		if !it.nextPage {
+			return false
+		}
+		if err := it.ctx.Err(); err != nil {
+			it.err = err
+			return false
+		}
+
+		resp, err := it.client.FindUsersContext(it.ctx, it.req)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.pos = resp.Users, 0
+		// an empty page can't be followed by users
+		it.nextPage = resp.NextPage && len(resp.Users) > 0
+		if resp.NextCursor != "" {
+			it.req.Cursor = resp.NextCursor
+		} else {
+			it.req.Offset += len(resp.Users)
+		}
+	}
+
+	it.user = it.page[it.pos]
+	it.pos++
+	it.count++
+	return true
+}
+
+// User returns the current user
+func (it *UserIterator) User() User {
+	return it.user
+}
+
+// Err returns the error stopped the iteration
+func (it *UserIterator) Err() error {
+	return it.err
+}
+
+// AllUsers collects users of all pages of the search, but no more than max if it is positive
+func (srv *SearchClient) AllUsers(ctx context.Context, req SearchRequest, max int) ([]User, error) {
+	users := []User{}
+	it := srv.Iterate(ctx, req, max)
+	for it.Next() {
+		users = append(users, it.User())
+	}
+	return users, it.Err()
+}
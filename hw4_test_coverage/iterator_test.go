@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+// countingServer counts requests handled by handlerTestServer
+func countingServer(requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		handlerTestServer(w, r)
+	}))
+}
+
+func TestIterateAllPages(t *testing.T) {
+	var requests int32
+	ts := countingServer(&requests)
+	defer ts.Close()
+
+	expected, err := usersFromXML("dataset.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc := &SearchClient{URL: ts.URL}
+	users, err := sc.AllUsers(context.Background(), SearchRequest{Limit: 10}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(users, expected) {
+		t.Errorf("got %d users, expected all %d users of the dataset", len(users), len(expected))
+	}
+	if atomic.LoadInt32(&requests) != 4 {
+		t.Errorf("expected 4 pages of 10 users, got %d requests", atomic.LoadInt32(&requests))
+	}
+
+	// zero limit means the biggest page
+	atomic.StoreInt32(&requests, 0)
+	users, err = sc.AllUsers(context.Background(), SearchRequest{}, 0)
+	if err != nil || len(users) != len(expected) || atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("got %d users in %d requests, error %v", len(users), atomic.LoadInt32(&requests), err)
+	}
+}
+
+func TestIterateCursors(t *testing.T) {
+	var requests int32
+	srv := newTestSearchServer(t, "")
+	cursors := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Query().Get("cursor") != "" {
+			cursors++
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	sc := &SearchClient{URL: ts.URL}
+	users, err := sc.AllUsers(context.Background(), SearchRequest{Limit: 10, Offset: 3, OrderField: "Id", OrderBy: OrderByDesc}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(users) != 32 || users[0].Id != 31 || users[31].Id != 0 {
+		t.Errorf("expected users 31..0, got %d users", len(users))
+	}
+	if atomic.LoadInt32(&requests) != 4 || cursors != 3 {
+		t.Errorf("expected 4 requests with 3 cursors, got %d with %d", atomic.LoadInt32(&requests), cursors)
+	}
+}
+
+func TestIterateMax(t *testing.T) {
+	var requests int32
+	ts := countingServer(&requests)
+	defer ts.Close()
+
+	sc := &SearchClient{URL: ts.URL}
+	users, err := sc.AllUsers(context.Background(), SearchRequest{Limit: 5}, 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(users) != 7 || users[6].Id != 6 {
+		t.Errorf("expected first 7 users, got %+v", users)
+	}
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("expected 2 requests, got %d", atomic.LoadInt32(&requests))
+	}
+
+	// nothing is found
+	users, err = sc.AllUsers(context.Background(), SearchRequest{Query: "no such user"}, 0)
+	if err != nil || len(users) != 0 {
+		t.Errorf("expected no users, got %v, %v", users, err)
+	}
+}
+
+func TestIterateStopsOnError(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		handlerTestServer(w, r)
+	}))
+	defer ts.Close()
+
+	sc := &SearchClient{URL: ts.URL}
+	it := sc.Iterate(context.Background(), SearchRequest{Limit: 10}, 0)
+	count := 0
+	for it.Next() {
+		count++
+	}
+	if count != 10 {
+		t.Errorf("expected the first page of 10 users, got %d", count)
+	}
+	if err := it.Err(); err == nil || err.Error() != "SearchServer fatal error" {
+		t.Errorf("expected server error, got %v", err)
+	}
+	if it.Next() || atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("iterator continued after error, %d requests", atomic.LoadInt32(&requests))
+	}
+}
+
+func TestIterateContextCanceled(t *testing.T) {
+	var requests int32
+	ts := countingServer(&requests)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sc := &SearchClient{URL: ts.URL}
+	it := sc.Iterate(ctx, SearchRequest{Limit: 10}, 0)
+
+	count := 0
+	for it.Next() {
+		count++
+		if count == 10 {
+			cancel()
+		}
+	}
+	if count != 10 || it.Err() != context.Canceled {
+		t.Errorf("expected to stop after the first page with context.Canceled, got %d users, %v", count, it.Err())
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("expected 1 request, got %d", atomic.LoadInt32(&requests))
+	}
+}
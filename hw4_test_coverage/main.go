@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen")
+	dataset := flag.String("dataset", "dataset.xml", "users dataset")
+	token := flag.String("token", "", "access token expected from clients, empty to allow everyone")
+	hmacKey := flag.String("hmac-key", "", "id:secret of clients signing requests")
+	flag.Parse()
+
+	srv, err := NewSearchServer(*dataset, *token)
+	if err != nil {
+		log.Fatalf("cant load dataset: %v", err)
+	}
+	if *hmacKey != "" {
+		parts := strings.SplitN(*hmacKey, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			log.Fatalf("bad -hmac-key %q, expecting id:secret", *hmacKey)
+		}
+		srv.HMACKeys = map[string][]byte{parts[0]: []byte(parts[1])}
+	}
+
+	log.Printf("search server listens on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, srv))
+}
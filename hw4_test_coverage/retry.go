@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrCircuitOpen is returned without a request while the circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// RetryPolicy repeats requests failed by transient errors with exponential backoff.
+// Search requests are GETs, so they are safe to repeat.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, it doubles with every next retry
+	BaseDelay time.Duration
+	// MaxDelay limits the delay, no limit if zero
+	MaxDelay time.Duration
+	// Jitter from 0 to 1 is the randomized share of the delay,
+	// so clients failed together don't retry together
+	Jitter float64
+}
+
+func (p *RetryPolicy) attempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// delay returns the pause after the failed attempt, attempts are counted from 0
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 0; i < attempt && (p.MaxDelay == 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(p.Jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// isTransient reports whether the failure may pass by itself.
+// Errors caused by the canceled context of the caller are not transient.
+func isTransient(ctx context.Context, status int, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil && isNetworkError(err)
+	}
+	switch status {
+	case http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isNetworkError reports whether err is a timeout, a temporary network error
+// or a connection reset by the server. Unknown hosts and refused connections
+// are not, like errors of building and authenticating the request:
+// repeating them won't help.
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var tempErr interface{ Temporary() bool }
+	if errors.As(err, &tempErr) && tempErr.Temporary() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET)
+}
+
+// sleep waits for d or until the context is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// send makes the request retrying transient failures by srv.Retry
+// and reporting results to srv.Breaker.
+// The result of the last attempt is returned if all of them failed.
+func (srv *SearchClient) send(ctx context.Context, params url.Values, header http.Header) (int, http.Header, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		if srv.Breaker != nil && !srv.Breaker.Allow() {
+			return 0, nil, nil, ErrCircuitOpen
+		}
+
+		status, respHeader, body, err := srv.sendOnce(ctx, params, header)
+		transient := isTransient(ctx, status, err)
+		if srv.Breaker != nil {
+			switch {
+			case ctx.Err() != nil:
+				srv.Breaker.Cancel()
+			case transient:
+				srv.Breaker.Failure()
+			case err != nil:
+				// the failure tells nothing about the health of the server
+				srv.Breaker.Cancel()
+			default:
+				srv.Breaker.Success()
+			}
+		}
+
+		if !transient || attempt+1 >= srv.Retry.attempts() {
+			return status, respHeader, body, err
+		}
+		if err := sleep(ctx, srv.Retry.delay(attempt)); err != nil {
+			return 0, nil, nil, err
+		}
+	}
+}
+
+// circuit breaker states
+const (
+	BreakerClosed = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+// CircuitBreaker opens after FailureThreshold failures in a row and fails requests
+// fast for OpenTimeout. Then a single trial request is let through: its success
+// closes the breaker and its failure opens it again. One breaker may be shared
+// by several clients of the same server.
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenTimeout      time.Duration
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewCircuitBreaker returns a closed breaker
+func NewCircuitBreaker(failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureThreshold: failureThreshold,
+		OpenTimeout:      openTimeout,
+	}
+}
+
+// State returns BreakerClosed, BreakerOpen or BreakerHalfOpen
+func (cb *CircuitBreaker) State() int {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// Allow reports whether a request may be made now
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case BreakerOpen:
+		if cb.clock().Sub(cb.openedAt) < cb.OpenTimeout {
+			return false
+		}
+		// let the trial request through
+		cb.state = BreakerHalfOpen
+		return true
+	case BreakerHalfOpen:
+		// the trial request is not finished yet
+		return false
+	}
+	return true
+}
+
+// Success closes the breaker
+func (cb *CircuitBreaker) Success() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.state = BreakerClosed
+	cb.failures = 0
+}
+
+// Failure counts the failure and opens the breaker if there are too many of them
+func (cb *CircuitBreaker) Failure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.failures++
+	if cb.state == BreakerHalfOpen || cb.failures >= cb.FailureThreshold {
+		cb.state = BreakerOpen
+		cb.openedAt = cb.clock()
+	}
+}
+
+// Cancel tells the request was canceled by the caller or not sent at all,
+// so nothing is known about the server.
+// After a canceled trial request the breaker is open for another OpenTimeout.
+func (cb *CircuitBreaker) Cancel() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == BreakerHalfOpen {
+		cb.state = BreakerOpen
+		cb.openedAt = cb.clock()
+	}
+}
+
+func (cb *CircuitBreaker) clock() time.Time {
+	if cb.now == nil {
+		return time.Now()
+	}
+	return cb.now()
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyServer fails the first failures requests with the status, or hangs until
+// the client gives up if status is 0, and then works as handlerTestServer
+func flakyServer(failures int32, status int, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(requests, 1) <= failures {
+			if status == 0 {
+				<-r.Context().Done()
+				return
+			}
+			w.WriteHeader(status)
+			return
+		}
+		handlerTestServer(w, r)
+	}))
+}
+
+func TestRetryTransientFailures(t *testing.T) {
+	cases := []struct {
+		name     string
+		status   int
+		failures int32
+		attempts int
+		ok       bool
+		requests int32
+	}{
+		{"500 then ok", http.StatusInternalServerError, 2, 3, true, 3},
+		{"503 then ok", http.StatusServiceUnavailable, 1, 3, true, 2},
+		{"timeout then ok", 0, 1, 2, true, 2},
+		{"always 500", http.StatusInternalServerError, 100, 3, false, 3},
+		{"no retries", http.StatusInternalServerError, 1, 0, false, 1},
+		{"400 is not retried", http.StatusBadRequest, 1, 3, false, 1},
+		{"401 is not retried", http.StatusUnauthorized, 1, 3, false, 1},
+	}
+
+	for _, c := range cases {
+		var requests int32
+		ts := flakyServer(c.failures, c.status, &requests)
+
+		// the timeout only ends the hanging request, the others parse the dataset in time
+		sc := &SearchClient{
+			URL:     ts.URL,
+			Timeout: time.Second,
+			Retry:   &RetryPolicy{MaxAttempts: c.attempts, BaseDelay: time.Millisecond, Jitter: 0.5},
+		}
+		sr, err := sc.FindUsers(SearchRequest{Limit: 1})
+		if c.ok && (err != nil || len(sr.Users) != 1) {
+			t.Errorf("%s: unexpected result %v, %v", c.name, sr, err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		}
+		if n := atomic.LoadInt32(&requests); n != c.requests {
+			t.Errorf("%s: expected %d requests, got %d", c.name, c.requests, n)
+		}
+		ts.Close()
+	}
+}
+
+// failingAuth can't authenticate requests
+type failingAuth struct{}
+
+func (failingAuth) Authenticate(r *http.Request) error {
+	return errors.New("no credentials")
+}
+
+func TestRetryPermanentErrors(t *testing.T) {
+	var requests int32
+	ts := flakyServer(0, http.StatusOK, &requests)
+	defer ts.Close()
+
+	cases := []struct {
+		name string
+		sc   *SearchClient
+	}{
+		{"bad url", &SearchClient{URL: "http://bad host"}},
+		{"unsupported scheme", &SearchClient{URL: "ftp://" + ts.Listener.Addr().String()}},
+		{"authentication", &SearchClient{URL: ts.URL, Auth: failingAuth{}}},
+	}
+	for _, c := range cases {
+		c.sc.Retry = &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+		c.sc.Breaker = NewCircuitBreaker(1, time.Minute)
+
+		if _, err := c.sc.FindUsers(SearchRequest{}); err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		}
+		if n := atomic.LoadInt32(&requests); n != 0 {
+			t.Errorf("%s: expected no requests, got %d", c.name, n)
+		}
+		if c.sc.Breaker.State() != BreakerClosed {
+			t.Errorf("%s: the error was counted as a failure of the server", c.name)
+		}
+	}
+}
+
+func TestRetryNetworkErrors(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		requests int
+	}{
+		{"refused", &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, 1},
+		{"unknown host", &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "search.invalid", IsNotFound: true}}, 1},
+		{"dns timeout", &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "timeout", Name: "search.invalid", IsTimeout: true}}, 3},
+		{"temporary dns", &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "server misbehaving", Name: "search.invalid", IsTemporary: true}}, 3},
+		{"reset", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, 3},
+	}
+	for _, c := range cases {
+		requests := 0
+		sc := &SearchClient{
+			URL: "http://search.invalid/",
+			Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				requests++
+				return nil, c.err
+			}),
+			Retry: &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond},
+		}
+		if _, err := sc.FindUsers(SearchRequest{}); !errors.Is(err, c.err) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.err, err)
+		}
+		if requests != c.requests {
+			t.Errorf("%s: expected %d requests, got %d", c.name, c.requests, requests)
+		}
+	}
+
+	// a refused connection says nothing about the health of the server
+	ts := httptest.NewServer(http.HandlerFunc(handlerTestServer))
+	ts.Close()
+	cb := NewCircuitBreaker(1, time.Minute)
+	sc := &SearchClient{URL: ts.URL, Breaker: cb}
+	if _, err := sc.FindUsers(SearchRequest{}); !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("expected a refused connection, got %v", err)
+	}
+	if cb.State() != BreakerClosed {
+		t.Errorf("the refused connection opened the breaker")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := &RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 30 * time.Millisecond}
+	expected := []time.Duration{10, 20, 30, 30, 30}
+	for i, d := range expected {
+		if got := p.delay(i); got != d*time.Millisecond {
+			t.Errorf("attempt %d: got %v, expected %v", i, got, d*time.Millisecond)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.delay(1); d < 10*time.Millisecond || d > 20*time.Millisecond {
+			t.Fatalf("delay %v is out of the jitter range", d)
+		}
+	}
+}
+
+func TestRetryStopsOnContextCancel(t *testing.T) {
+	var requests int32
+	ts := flakyServer(100, http.StatusInternalServerError, &requests)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	sc := &SearchClient{URL: ts.URL, Retry: &RetryPolicy{MaxAttempts: 5, BaseDelay: time.Minute}}
+	start := time.Now()
+	if _, err := sc.FindUsersContext(ctx, SearchRequest{}); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second || atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("backoff was not interrupted, %d requests", atomic.LoadInt32(&requests))
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var requests int32
+	ts := flakyServer(2, http.StatusInternalServerError, &requests)
+	defer ts.Close()
+
+	now := time.Now()
+	cb := NewCircuitBreaker(2, time.Minute)
+	cb.now = func() time.Time { return now }
+	sc := &SearchClient{URL: ts.URL, Breaker: cb}
+
+	for i := 0; i < 2; i++ {
+		if _, err := sc.FindUsers(SearchRequest{}); err == nil || err == ErrCircuitOpen {
+			t.Fatalf("[%d] expected server error, got %v", i, err)
+		}
+	}
+	if cb.State() != BreakerOpen {
+		t.Fatalf("breaker is not open after 2 failures")
+	}
+
+	// fails fast without requests
+	if _, err := sc.FindUsers(SearchRequest{}); err != ErrCircuitOpen {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+
+	// the server is healthy now, the trial request closes the breaker
+	now = now.Add(time.Minute)
+	if _, err := sc.FindUsers(SearchRequest{}); err != nil {
+		t.Errorf("unexpected error of the trial request: %v", err)
+	}
+	if cb.State() != BreakerClosed {
+		t.Errorf("breaker is not closed after the successful trial")
+	}
+}
+
+func TestCircuitBreakerTrial(t *testing.T) {
+	now := time.Now()
+	cb := NewCircuitBreaker(1, time.Second)
+	cb.now = func() time.Time { return now }
+
+	cb.Failure()
+	if cb.Allow() {
+		t.Fatal("open breaker allowed a request")
+	}
+
+	now = now.Add(time.Second)
+	if !cb.Allow() || cb.State() != BreakerHalfOpen {
+		t.Fatal("breaker did not let the trial request through")
+	}
+	if cb.Allow() {
+		t.Error("breaker allowed a second request during the trial")
+	}
+
+	// the failed trial opens the breaker for the next timeout
+	cb.Failure()
+	if cb.State() != BreakerOpen || cb.Allow() {
+		t.Error("breaker is not open after the failed trial")
+	}
+
+	// the canceled trial opens the breaker for the next timeout too
+	now = now.Add(time.Second)
+	cb.Allow()
+	cb.Cancel()
+	if cb.State() != BreakerOpen || cb.Allow() {
+		t.Error("breaker allowed a new trial right after the canceled one")
+	}
+	now = now.Add(time.Second)
+	if !cb.Allow() {
+		t.Error("breaker did not allow a new trial after the timeout")
+	}
+
+	// retries share the breaker
+	var requests int32
+	ts := flakyServer(100, http.StatusInternalServerError, &requests)
+	defer ts.Close()
+	sc := &SearchClient{
+		URL:     ts.URL,
+		Retry:   &RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond},
+		Breaker: NewCircuitBreaker(2, time.Minute),
+	}
+	if _, err := sc.FindUsers(SearchRequest{}); err != ErrCircuitOpen {
+		t.Errorf("expected ErrCircuitOpen after retries opened the breaker, got %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"hash/fnv"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Row struct {
+	ID            int    `xml:"id"`
+	GUID          string `xml:"guid"`
+	IsActive      bool   `xml:"isActive"`
+	Balance       string `xml:"balance"`
+	Picture       string `xml:"picture"`
+	Age           int    `xml:"age"`
+	EyeColor      string `xml:"eyeColor"`
+	FirstName     string `xml:"first_name"`
+	LastName      string `xml:"last_name"`
+	Gender        string `xml:"gender"`
+	Company       string `xml:"company"`
+	Email         string `xml:"email"`
+	Phone         string `xml:"phone"`
+	About         string `xml:"about"`
+	Registered    string `xml:"registered"`
+	FavoriteFruit string `xml:"favoriteFruit"`
+}
+
+type Rows struct {
+	Version string `xml:"version,attr"`
+	List    []Row  `xml:"row"`
+}
+
+// create []User from dataset.xml
+func usersFromXML(fileName string) ([]User, error) {
+	// open xml file
+	xmlFile, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer xmlFile.Close()
+
+	// read xml into Rows structure
+	rows := new(Rows)
+	byteValue, _ := ioutil.ReadAll(xmlFile)
+	err = xml.Unmarshal(byteValue, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// create and fullfil []User
+	users := make([]User, 0)
+	for _, row := range rows.List {
+		user := User{
+			Id:     row.ID,
+			Name:   row.FirstName + " " + row.LastName,
+			Age:    row.Age,
+			About:  row.About,
+			Gender: row.Gender,
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// SearchServer is the external system SearchClient talks to.
+// It searches users of the dataset loaded once by NewSearchServer.
+type SearchServer struct {
+	// AccessToken is expected in the AccessToken header or as a bearer token
+	AccessToken string
+	// HMACKeys are secrets of HMACAuth clients by their key ids.
+	// Without them and AccessToken requests are not checked.
+	HMACKeys map[string][]byte
+	// MaxClockSkew limits the age of signed requests, DefaultMaxClockSkew if zero
+	MaxClockSkew time.Duration
+	users        []User
+
+	mu sync.Mutex
+	// nonces of signed requests by the time they were seen
+	nonces map[string]time.Time
+	// nonceQueue has the same nonces from the oldest one, so they are expired from its front
+	nonceQueue []seenNonce
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewSearchServer loads users from the dataset file
+func NewSearchServer(fileName, accessToken string) (*SearchServer, error) {
+	users, err := usersFromXML(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &SearchServer{AccessToken: accessToken, users: users}, nil
+}
+
+// less functions of the fields users can be ordered by
+var userOrderFields = map[string]func(a, b *User) bool{
+	"Id":   func(a, b *User) bool { return a.Id < b.Id },
+	"Age":  func(a, b *User) bool { return a.Age < b.Age },
+	"Name": func(a, b *User) bool { return a.Name < b.Name },
+}
+
+// noLimit is the limit of a request without the limit parameter
+const noLimit = -1
+
+// searchFilter selects users of a search, zero fields select everybody
+type searchFilter struct {
+	// Query is a substring of QueryField, of Name or About if it is empty
+	Query      string `json:"q,omitempty"`
+	QueryField string `json:"qf,omitempty"`
+	// Terms are substrings like Query, all of them must be found or any if TermsOp is TermsOr
+	Terms   []string `json:"t,omitempty"`
+	TermsOp string   `json:"op,omitempty"`
+	// AgeMin and AgeMax are inclusive, zero AgeMax means no upper bound
+	AgeMin int    `json:"amin,omitempty"`
+	AgeMax int    `json:"amax,omitempty"`
+	Gender string `json:"g,omitempty"`
+}
+
+// queryFields are the fields Query and Terms can be searched in
+var queryFields = map[string]func(u *User) string{
+	"Name":  func(u *User) string { return u.Name },
+	"About": func(u *User) string { return u.About },
+}
+
+// contains reports whether the substring is in the query field of the user
+func (f *searchFilter) contains(user *User, substr string) bool {
+	if field, ok := queryFields[f.QueryField]; ok {
+		return strings.Contains(field(user), substr)
+	}
+	return strings.Contains(user.Name, substr) || strings.Contains(user.About, substr)
+}
+
+func (f *searchFilter) match(user *User) bool {
+	switch {
+	case user.Age < f.AgeMin:
+		return false
+	case f.AgeMax > 0 && user.Age > f.AgeMax:
+		return false
+	case f.Gender != "" && user.Gender != f.Gender:
+		return false
+	case !f.contains(user, f.Query):
+		return false
+	}
+	if len(f.Terms) == 0 {
+		return true
+	}
+
+	// with TermsOr the first found term decides, with TermsAnd the first missing one
+	or := f.TermsOp == TermsOr
+	for _, term := range f.Terms {
+		if f.contains(user, term) == or {
+			return or
+		}
+	}
+	return !or
+}
+
+// validate returns the error text for the client
+func (f *searchFilter) validate() string {
+	switch {
+	case f.AgeMin < 0 || f.AgeMax < 0 || (f.AgeMax > 0 && f.AgeMin > f.AgeMax):
+		return "ErrorBadAge"
+	case f.Gender != "" && f.Gender != "male" && f.Gender != "female":
+		return "ErrorBadGender"
+	case f.TermsOp != "" && f.TermsOp != TermsAnd && f.TermsOp != TermsOr:
+		return "ErrorBadTermsOp"
+	}
+	if _, ok := queryFields[f.QueryField]; f.QueryField != "" && !ok {
+		return "ErrorBadQueryField"
+	}
+	return ""
+}
+
+// searchParams are parsed query parameters of a request
+type searchParams struct {
+	limit      int
+	offset     int
+	filter     searchFilter
+	orderField string
+	orderBy    int
+}
+
+// searchCursor is the position in a search, clients get it base64 encoded
+// in NextCursorHeader and send it back as is in the cursor parameter
+type searchCursor struct {
+	Offset int `json:"o"`
+	searchFilter
+	OrderField string `json:"f"`
+	OrderBy    int    `json:"b"`
+}
+
+// encodeCursor returns the cursor of the same search as params starting from offset
+func encodeCursor(params searchParams, offset int) string {
+	data, _ := json.Marshal(searchCursor{
+		Offset:       offset,
+		searchFilter: params.filter,
+		OrderField:   params.orderField,
+		OrderBy:      params.orderBy,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string) (searchCursor, error) {
+	c := searchCursor{}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// parseSearchParams reads the request parameters, the error is the text for the client.
+// The cursor replaces offset, filter and order parameters.
+func parseSearchParams(r *http.Request) (searchParams, string) {
+	values := r.URL.Query()
+	params := searchParams{
+		filter: searchFilter{
+			Query:      values.Get("query"),
+			QueryField: values.Get("query_field"),
+			Terms:      values["term"],
+			TermsOp:    values.Get("terms_op"),
+			Gender:     values.Get("gender"),
+		},
+		orderField: values.Get("order_field"),
+	}
+
+	ints := []struct {
+		name    string
+		value   *int
+		errText string
+	}{
+		{"limit", &params.limit, "ErrorBadLimit"},
+		{"offset", &params.offset, "ErrorBadOffset"},
+		{"order_by", &params.orderBy, "ErrorBadOrderBy"},
+		{"age_min", &params.filter.AgeMin, "ErrorBadAge"},
+		{"age_max", &params.filter.AgeMax, "ErrorBadAge"},
+	}
+	for _, p := range ints {
+		raw := values.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return params, p.errText
+		}
+		*p.value = n
+	}
+
+	if raw := values.Get("cursor"); raw != "" {
+		c, err := decodeCursor(raw)
+		if err != nil {
+			return params, "ErrorBadCursor"
+		}
+		params.offset = c.Offset
+		params.filter = c.searchFilter
+		params.orderField = c.OrderField
+		params.orderBy = c.OrderBy
+	}
+
+	switch {
+	case params.limit < 0:
+		return params, "ErrorBadLimit"
+	case params.offset < 0:
+		return params, "ErrorBadOffset"
+	case params.orderBy < OrderByAsc || params.orderBy > OrderByDesc:
+		return params, "ErrorBadOrderBy"
+	}
+	if errText := params.filter.validate(); errText != "" {
+		return params, errText
+	}
+	if values.Get("limit") == "" {
+		params.limit = noLimit
+	}
+
+	// users are ordered by Name if the field is not set
+	if params.orderField == "" {
+		params.orderField = "Name"
+	}
+	if _, ok := userOrderFields[params.orderField]; !ok {
+		return params, "ErrorBadOrderField"
+	}
+	return params, ""
+}
+
+// search returns users matching the filter ordered and paginated by params.
+// The offset is a number of users to skip, without the limit all of them are returned.
+// More tells there are users after the page, one user over the limit is looked up for it.
+func (srv *SearchServer) search(params searchParams) (page []User, more bool) {
+	users := make([]User, 0)
+	for i := range srv.users {
+		if params.filter.match(&srv.users[i]) {
+			users = append(users, srv.users[i])
+		}
+	}
+
+	less := userOrderFields[params.orderField]
+	switch params.orderBy {
+	case OrderByAsc:
+		sort.SliceStable(users, func(i, j int) bool { return less(&users[i], &users[j]) })
+	case OrderByDesc:
+		sort.SliceStable(users, func(i, j int) bool { return less(&users[j], &users[i]) })
+	}
+
+	if params.offset >= len(users) {
+		return []User{}, false
+	}
+	users = users[params.offset:]
+	if params.limit != noLimit && len(users) > params.limit {
+		// one more user tells the client there is the next page
+		return users[:params.limit+1], true
+	}
+	return users, false
+}
+
+// responseETag is a strong ETag of the users page and its cursor
+func responseETag(data []byte, cursor string) string {
+	h := fnv.New64a()
+	h.Write(data)
+	h.Write([]byte(cursor))
+	return `"` + strconv.FormatUint(h.Sum64(), 16) + `"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// ServeHTTP handles requests from SearchClient
+func (srv *SearchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := srv.authenticate(r); err != nil {
+		writeJSON(w, http.StatusUnauthorized, SearchErrorResponse{Error: err.Error()})
+		return
+	}
+
+	params, errText := parseSearchParams(r)
+	if errText != "" {
+		writeJSON(w, http.StatusBadRequest, SearchErrorResponse{Error: errText})
+		return
+	}
+
+	users, more := srv.search(params)
+	data, err := json.Marshal(users)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	if more {
+		w.Header().Set(NextCursorHeader, encodeCursor(params, params.offset+params.limit))
+	}
+
+	// the same page has the same ETag, clients revalidate cached pages with it
+	etag := responseETag(data, w.Header().Get(NextCursorHeader))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func (srv *SearchServer) clock() time.Time {
+	if srv.now == nil {
+		return time.Now()
+	}
+	return srv.now()
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newTestSearchServer(t *testing.T, token string) *SearchServer {
+	srv, err := NewSearchServer("dataset.xml", token)
+	if err != nil {
+		t.Fatalf("cant load dataset: %v", err)
+	}
+	return srv
+}
+
+// serve sends the request with params to srv and returns the status and the body
+func serve(srv http.Handler, token string, params url.Values) (int, []byte) {
+	r := httptest.NewRequest("GET", "/?"+params.Encode(), nil)
+	r.Header.Set("AccessToken", token)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	return w.Code, w.Body.Bytes()
+}
+
+func searchIDs(t *testing.T, srv http.Handler, params url.Values) []int {
+	status, body := serve(srv, "", params)
+	if status != http.StatusOK {
+		t.Fatalf("%v: unexpected status %d: %s", params, status, body)
+	}
+	users := []User{}
+	if err := json.Unmarshal(body, &users); err != nil {
+		t.Fatalf("%v: bad json: %v", params, err)
+	}
+	ids := make([]int, len(users))
+	for i, user := range users {
+		ids[i] = user.Id
+	}
+	return ids
+}
+
+func TestSearchServerLoadsDataset(t *testing.T) {
+	srv := newTestSearchServer(t, "")
+	if len(srv.users) != 35 {
+		t.Errorf("expected 35 users, got %d", len(srv.users))
+	}
+	if _, err := NewSearchServer("missing.xml", ""); err == nil {
+		t.Error("expected an error for missing dataset")
+	}
+}
+
+func TestSearchServerQuery(t *testing.T) {
+	srv := newTestSearchServer(t, "")
+
+	if ids := searchIDs(t, srv, url.Values{"query": {"Boyd Wolf"}}); len(ids) != 1 || ids[0] != 0 {
+		t.Errorf("expected Boyd Wolf only, got %v", ids)
+	}
+	// About is searched too
+	ids := searchIDs(t, srv, url.Values{"query": {"Nulla"}})
+	if len(ids) < 2 {
+		t.Errorf("expected several users with Nulla in About, got %v", ids)
+	}
+	for _, id := range ids {
+		if user := srv.users[id]; !strings.Contains(user.Name+user.About, "Nulla") {
+			t.Errorf("user %d has no Nulla", id)
+		}
+	}
+	if ids := searchIDs(t, srv, url.Values{"query": {"no such user"}}); len(ids) != 0 {
+		t.Errorf("expected no users, got %v", ids)
+	}
+	if ids := searchIDs(t, srv, url.Values{}); len(ids) != len(srv.users) {
+		t.Errorf("empty query must return all users, got %d", len(ids))
+	}
+}
+
+func TestSearchServerFilters(t *testing.T) {
+	srv := newTestSearchServer(t, "")
+	contains := func(s string, terms ...string) (all, anyFound bool) {
+		all = true
+		for _, term := range terms {
+			found := strings.Contains(s, term)
+			all, anyFound = all && found, anyFound || found
+		}
+		return all, anyFound
+	}
+
+	cases := []struct {
+		params url.Values
+		match  func(u User) bool
+	}{
+		{url.Values{"age_min": {"30"}, "age_max": {"35"}}, func(u User) bool { return u.Age >= 30 && u.Age <= 35 }},
+		{url.Values{"age_min": {"30"}}, func(u User) bool { return u.Age >= 30 }},
+		{url.Values{"gender": {"female"}}, func(u User) bool { return u.Gender == "female" }},
+		{url.Values{"gender": {"male"}, "age_max": {"25"}}, func(u User) bool { return u.Gender == "male" && u.Age <= 25 }},
+		{url.Values{"query": {"B"}, "query_field": {"Name"}}, func(u User) bool { return strings.Contains(u.Name, "B") }},
+		{url.Values{"query": {"Nulla"}, "query_field": {"About"}}, func(u User) bool { return strings.Contains(u.About, "Nulla") }},
+		{url.Values{"term": {"Nulla", "elit"}}, func(u User) bool {
+			all, _ := contains(u.Name+"\n"+u.About, "Nulla", "elit")
+			return all
+		}},
+		{url.Values{"term": {"Nulla", "elit"}, "terms_op": {TermsOr}, "query_field": {"About"}}, func(u User) bool {
+			_, anyFound := contains(u.About, "Nulla", "elit")
+			return anyFound
+		}},
+		{url.Values{"query": {"a"}, "term": {"Boyd", "Hilda"}, "terms_op": {TermsOr}, "query_field": {"Name"}}, func(u User) bool {
+			_, anyFound := contains(u.Name, "Boyd", "Hilda")
+			return anyFound && strings.Contains(u.Name, "a")
+		}},
+	}
+
+	for _, c := range cases {
+		c.params.Set("order_field", "Id")
+		c.params.Set("order_by", strconv.Itoa(OrderByAsc))
+		ids := searchIDs(t, srv, c.params)
+		expected := []int{}
+		for _, user := range srv.users {
+			if c.match(user) {
+				expected = append(expected, user.Id)
+			}
+		}
+		if len(expected) == 0 || len(expected) == len(srv.users) {
+			t.Errorf("%v: the case selects %d users, it tests nothing", c.params, len(expected))
+		}
+		if !reflect.DeepEqual(ids, expected) {
+			t.Errorf("%v: got %v, expected %v", c.params, ids, expected)
+		}
+	}
+}
+
+func TestSearchServerOrder(t *testing.T) {
+	srv := newTestSearchServer(t, "")
+	byID := map[int]User{}
+	for _, user := range srv.users {
+		byID[user.Id] = user
+	}
+
+	cases := []struct {
+		field   string
+		orderBy int
+		ordered func(a, b User) bool
+	}{
+		{"Id", OrderByAsc, func(a, b User) bool { return a.Id <= b.Id }},
+		{"Id", OrderByDesc, func(a, b User) bool { return a.Id >= b.Id }},
+		{"Age", OrderByAsc, func(a, b User) bool { return a.Age <= b.Age }},
+		{"Age", OrderByDesc, func(a, b User) bool { return a.Age >= b.Age }},
+		{"Name", OrderByAsc, func(a, b User) bool { return a.Name <= b.Name }},
+		{"", OrderByDesc, func(a, b User) bool { return a.Name >= b.Name }},
+	}
+
+	for _, c := range cases {
+		ids := searchIDs(t, srv, url.Values{"order_field": {c.field}, "order_by": {strconv.Itoa(c.orderBy)}})
+		for i := 1; i < len(ids); i++ {
+			if !c.ordered(byID[ids[i-1]], byID[ids[i]]) {
+				t.Errorf("%s %d: wrong order %v", c.field, c.orderBy, ids)
+				break
+			}
+		}
+	}
+
+	// as is keeps the dataset order
+	ids := searchIDs(t, srv, url.Values{"order_field": {"Age"}, "order_by": {strconv.Itoa(OrderByAsIs)}})
+	for i, id := range ids {
+		if id != srv.users[i].Id {
+			t.Fatalf("OrderByAsIs changed the order: %v", ids)
+		}
+	}
+}
+
+func TestSearchServerLimitOffset(t *testing.T) {
+	srv := newTestSearchServer(t, "")
+	params := func(limit, offset string) url.Values {
+		return url.Values{
+			"order_field": {"Id"},
+			"order_by":    {strconv.Itoa(OrderByAsc)},
+			"limit":       {limit},
+			"offset":      {offset},
+		}
+	}
+
+	// one more user is returned if there is the next page
+	cases := []struct {
+		limit, offset string
+		expected      []int
+	}{
+		{"5", "3", []int{3, 4, 5, 6, 7, 8}},
+		{"3", "0", []int{0, 1, 2, 3}},
+		{"10", "33", []int{33, 34}},
+		{"2", "33", []int{33, 34}},
+		{"1", "35", []int{}},
+		{"", "34", []int{34}},
+		{"0", "10", []int{10}},
+	}
+	for _, c := range cases {
+		ids := searchIDs(t, srv, params(c.limit, c.offset))
+		if len(ids) != len(c.expected) {
+			t.Errorf("limit %s offset %s: got %v, expected %v", c.limit, c.offset, ids, c.expected)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != c.expected[i] {
+				t.Errorf("limit %s offset %s: got %v, expected %v", c.limit, c.offset, ids, c.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestSearchServerNextCursor(t *testing.T) {
+	srv := newTestSearchServer(t, "")
+	request := func(params url.Values) ([]int, string) {
+		r := httptest.NewRequest("GET", "/?"+params.Encode(), nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return searchIDs(t, srv, params), w.Header().Get(NextCursorHeader)
+	}
+
+	// the cursor keeps the query and the order, offset and query of the request are ignored
+	params := url.Values{"query": {"Nulla"}, "order_field": {"Id"}, "order_by": {strconv.Itoa(OrderByDesc)}, "limit": {"3"}}
+	all := searchIDs(t, srv, url.Values{"query": {"Nulla"}, "order_field": {"Id"}, "order_by": {strconv.Itoa(OrderByDesc)}})
+	got := []int{}
+	for pages := 0; ; pages++ {
+		if pages > len(all) {
+			t.Fatalf("too many pages: %v", got)
+		}
+		ids, cursor := request(params)
+		if cursor == "" {
+			got = append(got, ids...)
+			break
+		}
+		// the extra user is the first one of the next page
+		if len(ids) != 4 {
+			t.Fatalf("expected 3 users and the extra one, got %v", ids)
+		}
+		got = append(got, ids[:3]...)
+		params = url.Values{"cursor": {cursor}, "limit": {"3"}, "offset": {"100"}, "query": {"Boyd"}}
+	}
+	if len(got) != len(all) {
+		t.Fatalf("cursors gave %v, expected %v", got, all)
+	}
+	for i := range got {
+		if got[i] != all[i] {
+			t.Fatalf("cursors gave %v, expected %v", got, all)
+		}
+	}
+
+	// the last page has no cursor even if it is full
+	if _, cursor := request(url.Values{"limit": {"5"}, "offset": {"30"}}); cursor != "" {
+		t.Errorf("unexpected cursor %q of the last page", cursor)
+	}
+	if _, cursor := request(url.Values{}); cursor != "" {
+		t.Errorf("unexpected cursor %q without limit", cursor)
+	}
+}
+
+func TestSearchServerETag(t *testing.T) {
+	srv := newTestSearchServer(t, "")
+	request := func(params url.Values, etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/?"+params.Encode(), nil)
+		r.Header.Set("If-None-Match", etag)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return w
+	}
+
+	page := url.Values{"limit": {"5"}}
+	etag := request(page, "").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	if w := request(page, etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("expected 304 without body, got %d %s", w.Code, w.Body)
+	}
+	if w := request(url.Values{"limit": {"6"}}, etag); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("expected another page with another ETag, got %d %s", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestSearchServerBadRequest(t *testing.T) {
+	srv := newTestSearchServer(t, "")
+
+	cases := []struct {
+		params  url.Values
+		errText string
+	}{
+		{url.Values{"order_field": {"About"}}, "ErrorBadOrderField"},
+		{url.Values{"order_by": {"2"}}, "ErrorBadOrderBy"},
+		{url.Values{"order_by": {"asc"}}, "ErrorBadOrderBy"},
+		{url.Values{"limit": {"-1"}}, "ErrorBadLimit"},
+		{url.Values{"limit": {"ten"}}, "ErrorBadLimit"},
+		{url.Values{"offset": {"-5"}}, "ErrorBadOffset"},
+		{url.Values{"cursor": {"not a cursor"}}, "ErrorBadCursor"},
+		{url.Values{"age_min": {"30"}, "age_max": {"20"}}, "ErrorBadAge"},
+		{url.Values{"age_max": {"old"}}, "ErrorBadAge"},
+		{url.Values{"age_min": {"-1"}}, "ErrorBadAge"},
+		{url.Values{"gender": {"Male"}}, "ErrorBadGender"},
+		{url.Values{"query_field": {"Gender"}}, "ErrorBadQueryField"},
+		{url.Values{"terms_op": {"xor"}}, "ErrorBadTermsOp"},
+		{url.Values{"cursor": {encodeCursor(searchParams{orderField: "About"}, 0)}}, "ErrorBadOrderField"},
+	}
+	for _, c := range cases {
+		status, body := serve(srv, "", c.params)
+		errResp := SearchErrorResponse{}
+		json.Unmarshal(body, &errResp)
+		if status != http.StatusBadRequest || errResp.Error != c.errText {
+			t.Errorf("%v: got %d %s, expected 400 %s", c.params, status, body, c.errText)
+		}
+	}
+}
+
+func TestSearchServerAccessToken(t *testing.T) {
+	srv := newTestSearchServer(t, "secret")
+
+	if status, _ := serve(srv, "", url.Values{}); status != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", status)
+	}
+	if status, _ := serve(srv, "wrong", url.Values{}); status != http.StatusUnauthorized {
+		t.Errorf("expected 401 for wrong token, got %d", status)
+	}
+	if status, _ := serve(srv, "secret", url.Values{}); status != http.StatusOK {
+		t.Errorf("expected 200 for right token, got %d", status)
+	}
+}
+
+func TestFindUsersWithSearchServer(t *testing.T) {
+	ts := httptest.NewServer(newTestSearchServer(t, "secret"))
+	defer ts.Close()
+
+	sc := &SearchClient{AccessToken: "secret", URL: ts.URL}
+	resp, err := sc.FindUsers(SearchRequest{Limit: 2, Query: "Boyd", OrderField: "Id", OrderBy: OrderByAsc})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.Users) != 1 || resp.Users[0].Name != "Boyd Wolf" {
+		t.Errorf("unexpected users: %+v", resp.Users)
+	}
+
+	if _, err := sc.FindUsers(SearchRequest{OrderField: "About"}); err == nil || err.Error() != "OrderField About invalid" {
+		t.Errorf("expected bad order field error, got %v", err)
+	}
+
+	sc.AccessToken = "wrong"
+	if _, err := sc.FindUsers(SearchRequest{}); err == nil || err.Error() != "Bad AccessToken" {
+		t.Errorf("expected bad token error, got %v", err)
+	}
+}
+
+func TestFindUsersCursorWithSearchServer(t *testing.T) {
+	ts := httptest.NewServer(newTestSearchServer(t, "secret"))
+	defer ts.Close()
+	sc := &SearchClient{AccessToken: "secret", URL: ts.URL}
+
+	// pages by offset and by cursor are the same
+	page := SearchRequest{Limit: 4, Offset: 4, OrderField: "Age", OrderBy: OrderByAsc}
+	byOffset, err := sc.FindUsers(page)
+	if err != nil || len(byOffset.Users) != 4 || !byOffset.NextPage || byOffset.NextCursor == "" {
+		t.Fatalf("unexpected page %+v, %v", byOffset, err)
+	}
+	page.Offset = 0
+	first, err := sc.FindUsers(page)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	byCursor, err := sc.FindUsers(SearchRequest{Limit: 4, Cursor: first.NextCursor})
+	if err != nil || !reflect.DeepEqual(byCursor.Users, byOffset.Users) {
+		t.Errorf("page by cursor %+v differs from page by offset %+v, %v", byCursor.Users, byOffset.Users, err)
+	}
+
+	last, err := sc.FindUsers(SearchRequest{Limit: 10, Offset: 30, OrderField: "Id"})
+	if err != nil || len(last.Users) != 5 || last.NextPage || last.NextCursor != "" {
+		t.Errorf("unexpected last page %+v, %v", last, err)
+	}
+}
+
+func TestFindUsersFiltersWithSearchServer(t *testing.T) {
+	ts := httptest.NewServer(newTestSearchServer(t, "secret"))
+	defer ts.Close()
+	sc := &SearchClient{AccessToken: "secret", URL: ts.URL}
+
+	// filters are kept in cursors
+	filtered := SearchRequest{Limit: 2, AgeMin: 30, Gender: "female", Terms: []string{"Nulla", "elit"}, TermsOp: TermsOr}
+	all, err := sc.AllUsers(context.Background(), filtered, 0)
+	if err != nil || len(all) < 3 {
+		t.Fatalf("expected several pages of users, got %d, %v", len(all), err)
+	}
+	for _, user := range all {
+		if user.Age < 30 || user.Gender != "female" || !strings.Contains(user.Name+user.About, "Nulla") && !strings.Contains(user.Name+user.About, "elit") {
+			t.Errorf("user %+v does not match the filter", user)
+		}
+	}
+	if _, err := sc.FindUsers(SearchRequest{Gender: "unknown"}); err == nil || err.Error() != "unknown bad request error: ErrorBadGender" {
+		t.Errorf("expected bad gender error, got %v", err)
+	}
+}